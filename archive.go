@@ -0,0 +1,285 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ArchiveTag = "archive"
+	// remembers the checksum of the archive extracted in a dependency dir
+	ArchiveMarker = ".gopack-archive"
+)
+
+// The Archive scm downloads a .tar.gz or .zip release from an
+// http(s) or file:// source and extracts it in the vendor dir,
+// once its sha256 checksum matches the one in the config.
+type Archive struct{}
+
+func (a Archive) Init(d *Dep) error {
+	dest := dependencyPath(d.Import)
+
+	if revision, _ := a.Revision(dest); revision == d.Sha256 {
+		return nil
+	}
+
+	d.printf(Gray, "downloading %s\n", d.DownloadSource())
+	archive, err := downloadArchive(d.DownloadSource())
+	if err != nil {
+		return fmt.Errorf("Error downloading dependency: %s", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	sum := sha256.New()
+	if _, err = io.Copy(sum, archive); err != nil {
+		return err
+	}
+	if checksum := hex.EncodeToString(sum.Sum(nil)); checksum != d.Sha256 {
+		return fmt.Errorf("checksum mismatch for %s, expected sha256 %s but it was %s", d.Source, d.Sha256, checksum)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("Error creating import dir %s", err)
+	}
+
+	// extract next to the destination and swap it in when done
+	stage, err := ioutil.TempDir(filepath.Dir(dest), ".gopack-extract-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	if _, err = archive.Seek(0, 0); err != nil {
+		return err
+	}
+	if err = extractArchive(archive, stage); err != nil {
+		return fmt.Errorf("Error extracting %s: %s", d.Source, err)
+	}
+
+	root := archiveRoot(stage)
+	if err = ioutil.WriteFile(filepath.Join(root, ArchiveMarker), []byte(d.Sha256), 0644); err != nil {
+		return err
+	}
+
+	if err = os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(root, dest)
+}
+
+func (a Archive) DownloadCommand(source, path string) *exec.Cmd {
+	return exec.Command("curl", "-sSL", "-o", path, source)
+}
+
+func (a Archive) Checkout(d *Dep) error {
+	return nil
+}
+
+// Archives are downloaded again by Init when their checksum changes.
+func (a Archive) Fetch(path string) error {
+	return nil
+}
+
+// The revision of an extracted archive is its sha256 checksum.
+func (a Archive) Revision(path string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(path, ArchiveMarker))
+	return strings.TrimSpace(string(b)), err
+}
+
+func (a Archive) Tags(path string) ([]string, error) {
+	return nil, nil
+}
+
+// Archives have no history to compare with, gp verify
+// compares their content with the hash in gopack.lock.
+func (a Archive) Modified(path string) ([]string, error) {
+	return nil, nil
+}
+
+// A new release is a new source, there's no upstream to be behind.
+func (a Archive) Behind(path, branch string) (int, error) {
+	return 0, nil
+}
+
+// Download the archive to a temporary file.
+func downloadArchive(source string) (*os.File, error) {
+	var body io.ReadCloser
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s responded %s", source, resp.Status)
+		}
+		body = resp.Body
+	} else {
+		f, err := os.Open(strings.TrimPrefix(source, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		body = f
+	}
+	defer body.Close()
+
+	tmp, err := ioutil.TempFile("", "gopack-archive-")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(tmp, body); err == nil {
+		_, err = tmp.Seek(0, 0)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// Extract a zip or gzipped tar archive, telling them apart by their magic bytes.
+func extractArchive(f *os.File, dest string) error {
+	magic, err := bufio.NewReader(f).Peek(4)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte("PK\x03\x04")):
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return extractZip(f, stat.Size(), dest)
+	case bytes.Equal(magic[:2], []byte{0x1f, 0x8b}):
+		return extractTarGz(f, dest)
+	}
+	return fmt.Errorf("unknown archive format, only .tar.gz and .zip are supported")
+}
+
+func extractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archiveEntryPath(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeArchiveFile(target, os.FileMode(hdr.Mode), tr)
+		case tar.TypeSymlink, tar.TypeLink:
+			// a chain of links can point anywhere once they're all
+			// extracted, so none are and the archive is refused
+			return fmt.Errorf("%s is a link, archives with links can't be extracted", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(r io.ReaderAt, size int64, dest string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		target, err := archiveEntryPath(dest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a link, archives with links can't be extracted", f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(target, f.Mode(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Where an archive entry goes, refusing entries that escape dest.
+func archiveEntryPath(dest, name string) (string, error) {
+	target := filepath.Join(dest, name)
+	if target != dest && !strings.HasPrefix(target, dest+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the archive", name)
+	}
+	return target, nil
+}
+
+func writeArchiveFile(target string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// Release archives usually wrap everything in a single
+// directory like mylib-1.2.0/, which is skipped.
+func archiveRoot(dir string) string {
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name())
+	}
+	return dir
+}
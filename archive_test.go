@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+var archiveFiles = [][2]string{
+	{"mylib-1.0.0/lib.go", "package mylib\n"},
+	{"mylib-1.0.0/sub/sub.go", "package sub\n"},
+}
+
+func createTarGz() []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, file := range archiveFiles {
+		name, content := file[0], file[1]
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func createZip() []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range archiveFiles {
+		name, content := file[0], file[1]
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func checksum(b []byte) string {
+	h := sha256.New()
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func serveArchives() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mylib-1.0.0.tar.gz":
+			w.Write(createTarGz())
+		case "/mylib-1.0.0.zip":
+			w.Write(createZip())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func loadArchiveDependency(t *testing.T, source, sum string) (*Dep, error) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "archive"
+  source = "%s"
+  sha256 = "%s"
+`, source, sum))
+
+	config := loadTestConfig(pwd)
+	dependencies, err := config.LoadDependencyModel(NewGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dep := dependencies.DepList[0]
+	return dep, dep.Get()
+}
+
+func checkExtracted(t *testing.T, dep *Dep) {
+	for _, name := range []string{"lib.go", "sub/sub.go"} {
+		if _, err := os.Stat(path.Join(dep.Src(), name)); err != nil {
+			t.Errorf("Expected %s to be extracted in %s", name, dep.Src())
+		}
+	}
+}
+
+func TestTarGzArchive(t *testing.T) {
+	server := serveArchives()
+	defer server.Close()
+
+	dep, err := loadArchiveDependency(t, server.URL+"/mylib-1.0.0.tar.gz", checksum(createTarGz()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dep)
+
+	revision, _ := dep.CurrentRevision()
+	if revision != dep.Sha256 {
+		t.Errorf("Expected the revision to be the archive checksum but it was %s", revision)
+	}
+}
+
+func TestZipArchive(t *testing.T) {
+	server := serveArchives()
+	defer server.Close()
+
+	dep, err := loadArchiveDependency(t, server.URL+"/mylib-1.0.0.zip", checksum(createZip()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dep)
+}
+
+func TestFileArchive(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "gopack-archive-")
+	archive := path.Join(dir, "mylib-1.0.0.tar.gz")
+	ioutil.WriteFile(archive, createTarGz(), 0644)
+
+	dep, err := loadArchiveDependency(t, "file://"+archive, checksum(createTarGz()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkExtracted(t, dep)
+}
+
+func TestArchiveWithChainedLinks(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	// every link stays in the archive on its own, together they lead out
+	tw.WriteHeader(&tar.Header{Name: "a/b", Linkname: "..", Typeflag: tar.TypeSymlink})
+	tw.WriteHeader(&tar.Header{Name: "a/b/c", Linkname: "..", Typeflag: tar.TypeSymlink})
+	content := "package evil\n"
+	tw.WriteHeader(&tar.Header{Name: "a/b/c/evil.go", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+	tw.Write([]byte(content))
+	tw.Close()
+	gz.Close()
+
+	parent, _ := ioutil.TempDir("", "gopack-archive-")
+	dest := path.Join(parent, "dest")
+	createPath(dest)
+
+	if err := extractTarGz(&buf, dest); err == nil {
+		t.Error("Expected an archive with links to be refused")
+	}
+	if _, err := os.Stat(path.Join(parent, "evil.go")); err == nil {
+		t.Error("Expected nothing to be extracted outside of the archive")
+	}
+}
+
+func TestZipArchiveWithLinks(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	header := &zip.FileHeader{Name: "mylib-1.0.0/lib.go"}
+	header.SetMode(os.ModeSymlink | 0777)
+	w, _ := zw.CreateHeader(header)
+	w.Write([]byte("/etc/passwd"))
+	zw.Close()
+
+	dest, _ := ioutil.TempDir("", "gopack-archive-")
+	if err := extractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dest); err == nil {
+		t.Error("Expected an archive with links to be refused")
+	}
+	if _, err := os.Lstat(path.Join(dest, "mylib-1.0.0", "lib.go")); err == nil {
+		t.Error("Expected the link not to be extracted")
+	}
+}
+
+func TestArchiveChecksumMismatch(t *testing.T) {
+	server := serveArchives()
+	defer server.Close()
+
+	dep, err := loadArchiveDependency(t, server.URL+"/mylib-1.0.0.tar.gz", checksum([]byte("something else")))
+	if err == nil {
+		t.Fatal("Expected an archive with a different checksum to fail")
+	}
+
+	if _, err := os.Stat(dep.Src()); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be extracted when the checksum doesn't match")
+	}
+}
+
+func TestArchiveRequiresChecksum(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	fixtures := []string{`
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "archive"
+  source = "https://example.com/mylib-1.0.0.tar.gz"`, `
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "archive"
+  source = "https://example.com/mylib-1.0.0.tar.gz"
+  sha256 = "not-a-checksum"`, `
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "git"
+  source = "https://example.com/mylib.git"
+  sha256 = "` + checksum(createTarGz()) + `"`}
+
+	for _, fixture := range fixtures {
+		createFixtureConfig(pwd, fixture)
+		config := loadTestConfig(pwd)
+		if _, err := config.LoadDependencyModel(NewGraph()); err == nil {
+			t.Errorf("Expected an invalid archive dependency to fail - %s", fixture)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var cacheKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Scms that keep a copy of every repository in the cache shared by
+// all the projects of the user, so it's only cloned once.
+type cachedScm interface {
+	// Clone source to dir in the cache, or fetch it if it's there already.
+	UpdateCache(source, dir string) error
+	// Create the checkout in path from the copy in the cache.
+	CloneCache(dir, path string) error
+}
+
+// The shared cache lives in $GOPACK_CACHE, ~/.cache/gopack by default.
+// GOPACK_CACHE=off disables it.
+func cacheDir() string {
+	if dir := os.Getenv("GOPACK_CACHE"); dir != "" {
+		if dir == "off" {
+			return ""
+		}
+		return dir
+	}
+
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".cache", "gopack")
+	}
+	return ""
+}
+
+// Where the repository cloned from source is cached.
+func cachePath(scmType, source string) string {
+	h := sha256.New()
+	h.Write([]byte(source))
+	key := strings.Trim(cacheKeyChars.ReplaceAllString(source, "_"), "_")
+	return filepath.Join(cacheDir(), scmType, key+"-"+hex.EncodeToString(h.Sum(nil)[:4]))
+}
+
+// Whether the repository in dir is a copy in the cache.
+func inCache(dir string) bool {
+	cache := cacheDir()
+	return cache != "" && strings.HasPrefix(filepath.Clean(dir), filepath.Clean(cache)+string(filepath.Separator))
+}
+
+// Bring the cache up to date and create the checkout of the dep from it.
+func downloadThroughCache(d *Dep, depPath string, scm cachedScm) error {
+	dir := cachePath(d.Scm, d.Source)
+
+	if _, err := os.Stat(dir); err == nil {
+		d.printf(Gray, "updating the cached %s\n", d.Source)
+		if err = scm.UpdateCache(d.DownloadSource(), dir); err != nil {
+			return fmt.Errorf("Error updating the cached %s: %s", d.Source, err)
+		}
+	} else {
+		d.printf(Gray, "downloading %s\n", d.DownloadSource())
+		if err = cloneToCache(d.DownloadSource(), dir, scm); err != nil {
+			return fmt.Errorf("Error downloading dependency: %s", err)
+		}
+	}
+
+	return cloneFromCache(dir, depPath, scm)
+}
+
+// Clone next to dir and move the clone in place when it's complete,
+// so other projects never find half a repository in the cache.
+func cloneToCache(source, dir string, scm cachedScm) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+
+	stage, err := ioutil.TempDir(filepath.Dir(dir), ".clone-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	clone := filepath.Join(stage, "repo")
+	if err = scm.UpdateCache(source, clone); err != nil {
+		return err
+	}
+
+	if err = os.Rename(clone, dir); err != nil {
+		// another project cached it first
+		if _, e := os.Stat(dir); e == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func cloneFromCache(dir, depPath string, scm cachedScm) error {
+	// scms want to create the checkout dir themselves
+	os.Remove(depPath)
+	if err := scm.CloneCache(dir, depPath); err != nil {
+		return fmt.Errorf("Error creating %s from the cache: %s", depPath, err)
+	}
+	return nil
+}
+
+// Create the checkout of the dep from the cache without reaching
+// the network, when the dep was cached by any project before.
+func (d *Dep) checkoutFromCache() bool {
+	if cacheDir() == "" || d.Source == "" {
+		return false
+	}
+
+	scm, err := NewScm(d)
+	if err != nil {
+		return false
+	}
+	cached, ok := scm.(cachedScm)
+	if !ok {
+		return false
+	}
+
+	dir := cachePath(d.Scm, d.Source)
+	if _, err = os.Stat(dir); err != nil {
+		return false
+	}
+
+	if err = os.MkdirAll(filepath.Dir(d.Src()), 0755); err != nil {
+		return false
+	}
+	d.printf(Gray, "checking out %s from the cache\n", d.Import)
+	return cloneFromCache(dir, d.Src(), cached) == nil
+}
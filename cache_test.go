@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Set up a new project depending on repo, sharing the cache of the previous one.
+func setupCachedProject(t *testing.T, repo string) *Dependencies {
+	cache := os.Getenv("GOPACK_CACHE")
+	createGitProject(repo, `branch = "master"`)
+	os.Setenv("GOPACK_CACHE", cache)
+
+	_, deps := loadTestConfiguration(pwd)
+	return deps
+}
+
+func TestDownloadThroughCache(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	setupTestPwd()
+	deps := setupCachedProject(t, repo)
+	check(loadTransitiveDependencies(deps))
+
+	dir := cachePath(GitTag, repo)
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("Expected %s to be cached in %s", repo, dir)
+	}
+	if origin := git(t, deps.DepList[0].Src(), "config", "--get", "remote.origin.url"); origin != dir {
+		t.Errorf("Expected the checkout to be cloned from the cache but it was cloned from %s", origin)
+	}
+
+	// a second project gets the new commits through the cache
+	second := commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 2\n")
+	deps = setupCachedProject(t, repo)
+	check(loadTransitiveDependencies(deps))
+
+	if revision, _ := deps.DepList[0].CurrentRevision(); revision != second {
+		t.Errorf("Expected the second project at %s but it was at %s", second, revision)
+	}
+
+	// and the first project too when updating
+	third := commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 3\n")
+	if err := deps.DepList[0].Update(); err != nil {
+		t.Fatal(err)
+	}
+	if revision, _ := deps.DepList[0].CurrentRevision(); revision != third {
+		t.Errorf("Expected the update to reach %s but it was at %s", third, revision)
+	}
+}
+
+func TestOfflineCheckoutFromCache(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	revision := commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	setupTestPwd()
+	check(loadTransitiveDependencies(setupCachedProject(t, repo)))
+
+	// nothing can be fetched anymore
+	os.RemoveAll(repo)
+
+	offline = true
+	defer func() { offline = false }()
+
+	deps := setupCachedProject(t, repo)
+	if errors := fetchDependencies(deps.DepList); len(errors) != 0 {
+		t.Fatalf("Expected the cached dependency to be used offline, found %v", errors)
+	}
+
+	if current, _ := deps.DepList[0].CurrentRevision(); current != revision {
+		t.Errorf("Expected dependency at %s but it was %s", revision, current)
+	}
+}
+
+func TestCacheOff(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	setupTestPwd()
+	defer os.Setenv("GOPACK_CACHE", os.Getenv("GOPACK_CACHE"))
+	os.Setenv("GOPACK_CACHE", "off")
+
+	deps := setupCachedProject(t, repo)
+	check(loadTransitiveDependencies(deps))
+
+	if origin := git(t, deps.DepList[0].Src(), "config", "--get", "remote.origin.url"); origin != repo {
+		t.Errorf("Expected the checkout to be cloned from %s without cache but it was cloned from %s", repo, origin)
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	defer os.Setenv("GOPACK_CACHE", os.Getenv("GOPACK_CACHE"))
+	os.Setenv("GOPACK_CACHE", "/cache")
+
+	https := cachePath(GitTag, "https://github.com/gorilla/mux")
+	ssh := cachePath(GitTag, "git@github.com:gorilla/mux.git")
+
+	if !strings.HasPrefix(https, "/cache/git/https_github.com_gorilla_mux-") || https == ssh {
+		t.Errorf("Expected sources to be cached apart, %s and %s", https, ssh)
+	}
+	if !inCache(https) || inCache("/elsewhere/mux") {
+		t.Errorf("Expected only paths in /cache to be in the cache")
+	}
+}
@@ -1,33 +1,44 @@
 package main
 
 import (
-	"bytes"
-	"crypto/md5"
-	"encoding/hex"
 	"fmt"
 	"github.com/pelletier/go-toml"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 type Config struct {
-	Checksum []byte
 	// Path to the configuration file.
 	Path string
 	// Name of your repository "github.com/d2fn/gopack" for instance.
 	Repository string
 	// Dependencies tree
 	DepsTree *toml.TomlTree
+	// Revisions pinned by gopack.lock, shared with transitive configs.
+	Lock *Lock
+	// What the deps resolved to on the last run, shared with transitive configs.
+	Fingerprints Fingerprints
+	// Where sources are downloaded from instead, shared with transitive configs.
+	Mirrors Mirrors
+	// Versions used instead of the declared ones, set by the root config only.
+	Replacements Replacements
+	// The dependency this config was found in, nil for the root config.
+	Parent *Dep
+	// Where the file declares its tables.
+	declared declarations
 }
 
-func NewConfig(dir string) *Config {
+func NewConfig(dir string) (*Config, error) {
 	config := &Config{Path: fmt.Sprintf("%s/gopack.config", dir)}
 
-	t, err := toml.LoadFile(config.Path)
+	t, declared, err := loadTomlFile(config.Path)
 	if err != nil {
-		fail(err)
+		return nil, &ConfigError{config.Path, err}
 	}
+	config.declared = declared
 
 	if deps := t.Get("deps"); deps != nil {
 		config.DepsTree = deps.(*toml.TomlTree)
@@ -37,10 +48,18 @@ func NewConfig(dir string) *Config {
 		config.Repository = repo.(string)
 	}
 
-	return config
+	if config.Mirrors, err = loadMirrors(t, declared, config.Path); err != nil {
+		return nil, &ConfigError{config.Path, err}
+	}
+
+	if config.Replacements, err = config.loadReplacements(t); err != nil {
+		return nil, &ConfigError{config.Path, err}
+	}
+
+	return config, nil
 }
 
-func (c *Config) InitRepo(importGraph *Graph) {
+func (c *Config) InitRepo(importGraph *Graph) error {
 	if c.Repository != "" {
 		src := fmt.Sprintf("%s/%s/src", pwd, VendorDir)
 		os.MkdirAll(src, 0755)
@@ -52,44 +71,32 @@ func (c *Config) InitRepo(importGraph *Graph) {
 		repo := fmt.Sprintf("%s/%s", src, c.Repository)
 		err := os.Symlink(pwd, repo)
 		if err != nil && !os.IsExist(err) {
-			fail(err)
+			return err
 		}
 
 		dependency := NewDependency(c.Repository)
+		dependency.Origin = c.Path
+		importGraph.Root = c.Repository
 		importGraph.Insert(dependency)
 	}
+	return nil
 }
 
-func (c *Config) modifiedChecksum() bool {
-	dat, err := ioutil.ReadFile(c.checksumPath())
-	return (err != nil && os.IsNotExist(err)) || !bytes.Equal(dat, c.checksum())
-}
-
-func (c *Config) WriteChecksum() {
-	os.MkdirAll(filepath.Join(pwd, GopackDir), 0755)
-	err := ioutil.WriteFile(c.checksumPath(), c.checksum(), 0644)
-
-	if err != nil {
-		fail(err)
+// Settings that only the root config can define
+// apply to every transitive config as well.
+func (c *Config) inherit(root *Config) {
+	if root != nil {
+		c.Lock = root.Lock
+		c.Fingerprints = root.Fingerprints
+		c.Mirrors = root.Mirrors
+		c.Replacements = root.Replacements
 	}
 }
 
-func (c *Config) checksumPath() string {
-	return filepath.Join(pwd, GopackChecksum)
-}
-
-func (c *Config) checksum() []byte {
-	if c.Checksum == nil {
-		dat, err := ioutil.ReadFile(c.Path)
-		if err != nil {
-			fail(err)
-		}
-
-		h := md5.New()
-		h.Write(dat)
-		c.Checksum = h.Sum(nil)
-	}
-	return []byte(hex.EncodeToString(c.Checksum))
+// Record the revisions resolved for deps in the lock file.
+func (c *Config) WriteLock(deps *Dependencies) error {
+	c.Lock.Record(deps.Resolved())
+	return c.Lock.Write()
 }
 
 func (c *Config) LoadDependencyModel(importGraph *Graph) (deps *Dependencies, err error) {
@@ -101,36 +108,124 @@ func (c *Config) LoadDependencyModel(importGraph *Graph) (deps *Dependencies, er
 
 	deps = new(Dependencies)
 
-	deps.Imports = make([]string, len(depsTree.Keys()))
-	deps.Keys = make([]string, len(depsTree.Keys()))
-	deps.DepList = make([]*Dep, len(depsTree.Keys()))
+	deps.Imports = []string{}
+	deps.Keys = []string{}
+	deps.DepList = []*Dep{}
 	deps.ImportGraph = importGraph
+	deps.Config = c
 
-	modifiedChecksum := c.modifiedChecksum()
+	for _, k := range c.declared.keys(depsTree, "deps") {
+		d, err := c.loadDep(depsTree.Get(k).(*toml.TomlTree))
+		if err != nil {
+			return nil, &ConfigError{c.Path, err}
+		}
 
-	for i, k := range depsTree.Keys() {
-		depTree := depsTree.Get(k).(*toml.TomlTree)
-		d := NewDependency(depTree.Get("import").(string))
+		deps.ImportGraph.Require(c.parentImport(), d)
 
-		d.setScm(depTree)
-		d.setSource(depTree)
+		// imports already declared by another config are resolved once
+		if !deps.ImportGraph.Insert(d) {
+			continue
+		}
+
+		c.Lock.Pin(d)
+		d.Fetch(c.Fingerprints.Changed(d))
+
+		deps.Keys = append(deps.Keys, k)
+		deps.Imports = append(deps.Imports, d.Import)
+		deps.DepList = append(deps.DepList, d)
+	}
 
-		d.setCheckout(depTree, "branch", BranchFlag)
-		d.setCheckout(depTree, "commit", CommitFlag)
-		d.setCheckout(depTree, "tag", TagFlag)
+	return deps, nil
+}
+
+// The line of every table header of a toml file, by table name,
+// since go-toml keeps the keys of a tree in a map.
+type declarations map[string]int
+
+func loadTomlFile(path string) (*toml.TomlTree, declarations, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
 
-		if err := d.Validate(); err != nil {
-			return nil, err
+	t, err := toml.Load(string(content))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	declared := declarations{}
+	for i, line := range strings.Split(string(content), "\n") {
+		if name := tableName(line); name != "" {
+			declared[name] = i
 		}
+	}
+	return t, declared, nil
+}
 
-		d.Fetch(modifiedChecksum)
+// The keys of the tree of the table in the order the file declares them.
+func (d declarations) keys(t *toml.TomlTree, table string) []string {
+	sorted := &declaredKeys{keys: t.Keys()}
+	for _, k := range sorted.keys {
+		sorted.lines = append(sorted.lines, d[table+"."+k])
+	}
+	sort.Sort(sorted)
+	return sorted.keys
+}
 
-		deps.Keys[i] = k
-		deps.Imports[i] = d.Import
-		deps.DepList[i] = d
+// Sorts keys by the line of their table, then by name.
+type declaredKeys struct {
+	keys  []string
+	lines []int
+}
+
+func (s *declaredKeys) Len() int { return len(s.keys) }
+
+func (s *declaredKeys) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.lines[i], s.lines[j] = s.lines[j], s.lines[i]
+}
 
-		deps.ImportGraph.Insert(d)
+func (s *declaredKeys) Less(i, j int) bool {
+	if s.lines[i] != s.lines[j] {
+		return s.lines[i] < s.lines[j]
 	}
+	return s.keys[i] < s.keys[j]
+}
 
-	return deps, nil
+func (c *Config) parentImport() string {
+	if c.Parent == nil {
+		return ""
+	}
+	return c.Parent.Import
+}
+
+// Build the dependency declared by a [deps.<name>] table of the config.
+func (c *Config) loadDep(depTree *toml.TomlTree) (*Dep, error) {
+	d := c.newDep(depTree)
+	c.Replacements.apply(d)
+
+	if d.Scm != LocalTag {
+		if mirror := c.Mirrors.Rewrite(d.Source); mirror != d.Source {
+			d.Mirror = mirror
+		}
+	}
+
+	return d, d.Validate()
+}
+
+// The dependency exactly as a table of this config declares it.
+func (c *Config) newDep(depTree *toml.TomlTree) *Dep {
+	d := NewDependency(depTree.Get("import").(string))
+	d.Origin = c.Path
+
+	d.setScm(depTree)
+	d.setSource(depTree)
+	d.setSha256(depTree)
+
+	d.setCheckout(depTree, "branch", BranchFlag)
+	d.setCheckout(depTree, "commit", CommitFlag)
+	d.setCheckout(depTree, "tag", TagFlag)
+	d.setCheckout(depTree, "version", VersionFlag)
+
+	return d
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -17,7 +18,14 @@ func setupTestConfig(fixture string) *Config {
 	setupEnv()
 
 	createFixtureConfig(pwd, fixture)
-	return NewConfig(pwd)
+	return loadTestConfig(pwd)
+}
+
+// NewConfig for the configs a test expects to be valid.
+func loadTestConfig(dir string) *Config {
+	config, err := NewConfig(dir)
+	check(err)
+	return config
 }
 
 func TestNewConfig(t *testing.T) {
@@ -46,7 +54,7 @@ func TestInitRepoWithoutRepo(t *testing.T) {
 `)
 
 	graph := NewGraph()
-	config.InitRepo(graph)
+	check(config.InitRepo(graph))
 
 	src := path.Join(pwd, VendorDir, "src")
 	_, err := os.Stat(src)
@@ -60,7 +68,7 @@ func TestInitRepo(t *testing.T) {
 	config := setupTestConfig(`repo = "github.com/d2fn/gopack"`)
 
 	graph := NewGraph()
-	config.InitRepo(graph)
+	check(config.InitRepo(graph))
 
 	dep := path.Join(pwd, VendorDir, "src", "github.com", "d2fn", "gopack")
 	stat, err := os.Stat(dep)
@@ -74,23 +82,41 @@ func TestInitRepo(t *testing.T) {
 	}
 }
 
-func TestWriteChecksum(t *testing.T) {
+// Load the dependency model like the next run of gopack does,
+// once the first one vendored the deps and recorded their fingerprints.
+func loadUnchanged(config *Config) *Dependencies {
+	deps, _ := config.LoadDependencyModel(NewGraph())
+	for _, d := range deps.DepList {
+		createPath(d.Src())
+	}
+	check(config.WriteFingerprints(deps))
+
+	config.Fingerprints, _ = LoadFingerprints()
+	deps, _ = config.LoadDependencyModel(NewGraph())
+	return deps
+}
+
+func TestWriteFingerprints(t *testing.T) {
 	config := setupTestConfig(`
 [deps.testgopack]
   import = "github.com/calavera/testGoPack"
   branch = "master"
 `)
 
-	config.WriteChecksum()
+	deps, _ := config.LoadDependencyModel(NewGraph())
+	check(config.WriteFingerprints(deps))
+
+	fingerprints, err := LoadFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	path := path.Join(pwd, GopackChecksum)
-	_, err := ioutil.ReadFile(path)
-	if err != nil && os.IsNotExist(err) {
-		t.Errorf("Expected checksum file %s to exist", path)
+	if fingerprints["github.com/calavera/testGoPack"] != deps.DepList[0].Fingerprint() {
+		t.Errorf("Expected the fingerprint of the dependency to be written to %s", fingerprintsPath())
 	}
 }
 
-func TestFetchDependenciesWithoutChecksum(t *testing.T) {
+func TestFetchDependenciesWithoutFingerprints(t *testing.T) {
 	config := setupTestConfig(`
 [deps.testgopack]
   import = "github.com/calavera/testGoPack"
@@ -98,7 +124,7 @@ func TestFetchDependenciesWithoutChecksum(t *testing.T) {
 `)
 
 	if cfg, _ := config.LoadDependencyModel(NewGraph()); !cfg.AllDepsNeedFetching() {
-		t.Errorf("Expected to load all the dependencies when there is no checksum")
+		t.Errorf("Expected to load all the dependencies when there are no fingerprints")
 	}
 }
 
@@ -108,9 +134,7 @@ func TestFetchDependenciesWithoutChanges(t *testing.T) {
   import = "github.com/calavera/testGoPack"
   commit = "182cae2ee3926a960223d8db4998aa9d57c89788"
 `)
-	config.WriteChecksum()
-
-	deps, _ := config.LoadDependencyModel(NewGraph())
+	deps := loadUnchanged(config)
 	if deps.AnyDepsNeedFetching() {
 		t.Errorf("Expected to not load any dependency with commit flag")
 	}
@@ -122,9 +146,7 @@ func TestFetchDependenciesWithBranch(t *testing.T) {
   import = "github.com/calavera/testGoPack"
   branch = "master"
 `)
-	config.WriteChecksum()
-
-	deps, _ := config.LoadDependencyModel(NewGraph())
+	deps := loadUnchanged(config)
 	if len(deps.DepList) != 1 {
 		t.Errorf("Expected to load any dependency with branch flag")
 	}
@@ -135,24 +157,67 @@ func TestFetchDependenciesWithChanges(t *testing.T) {
 [deps.testgopack]
   import = "github.com/calavera/testGoPack"
   commit = "182cae2ee3926a960223d8db4998aa9d57c89788"
+[deps.foo]
+  import = "github.com/calavera/foo"
+  tag = "v1.0.0"
 `)
+	loadUnchanged(config)
 
-	config.WriteChecksum()
-	config.Checksum = nil
-
-	fixture := `
+	createFixtureConfig(pwd, `
+# comments and formatting don't matter
 [deps.testgopack]
-  import = "github.com/calavera/testGoPack"
-  commit = "182cae2ee3926a960223d8db4998aa9d57c89788"
+import = "github.com/calavera/testGoPack"
+commit = "182cae2ee3926a960223d8db4998aa9d57c89788"
+
 [deps.foo]
-  import = "github.com/calavera/foo"
-  branch = "master"
-`
-	createFixtureConfig(pwd, fixture)
+import = "github.com/calavera/foo"
+tag = "v1.1.0"
+`)
+	config = loadTestConfig(pwd)
+	config.Fingerprints, _ = LoadFingerprints()
 
 	deps, _ := config.LoadDependencyModel(NewGraph())
-	if len(deps.DepList) != 1 {
-		t.Errorf("Expected to load only the new dependencies")
+	for _, dep := range deps.DepList {
+		changed := dep.Import == "github.com/calavera/foo"
+		if dep.fetch != changed {
+			t.Errorf("Expected %s to be fetched only if its tag changed", dep.Import)
+		}
+	}
+}
+
+func TestDependenciesInDeclarationOrder(t *testing.T) {
+	names := []string{"zeta", "alpha", "mu", "beta", "omega", "gamma", "kappa", "delta"}
+	fixture := ""
+	for _, name := range names {
+		fixture += fmt.Sprintf("[deps.%s]\n  import = \"example.com/%s\"\n  branch = \"master\"\n\n", name, name)
+	}
+	config := setupTestConfig(fixture)
+
+	deps, err := config.LoadDependencyModel(NewGraph())
+	check(err)
+	for i, name := range names {
+		if deps.Keys[i] != name || deps.DepList[i].Import != "example.com/"+name {
+			t.Fatalf("Expected the dependencies in the order gopack.config declares them, got %v", deps.Keys)
+		}
+	}
+}
+
+func TestRefetchDeletedVendorDir(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	git(t, repo, "tag", "v1.0.0")
+
+	setupGitProject(t, repo, `tag = "v1.0.0"`)
+	check(os.RemoveAll(path.Join(pwd, VendorDir)))
+
+	_, deps := loadTestConfiguration(pwd)
+	if !deps.DepList[0].fetch {
+		t.Errorf("Expected a dependency missing from the vendor dir to be fetched again")
+	}
+	check(loadTransitiveDependencies(deps))
+
+	if _, err := os.Stat(path.Join(deps.DepList[0].Src(), "lib.go")); err != nil {
+		t.Errorf("Expected the dependency to be vendored again: %s", err)
 	}
 }
 
@@ -165,9 +230,7 @@ func TestFetchWithCommitSpecs(t *testing.T) {
   import = "github.com/calavera/foo"
   branch = "master"
 `)
-	config.WriteChecksum()
-
-	deps, _ := config.LoadDependencyModel(NewGraph())
+	deps := loadUnchanged(config)
 	if deps.DepList[0].fetch {
 		t.Errorf("Expected to not fetch the commit dependencies")
 	}
@@ -185,9 +248,7 @@ func TestFetchWithTagSpecs(t *testing.T) {
   import = "github.com/calavera/foo"
   branch = "master"
 `)
-	config.WriteChecksum()
-
-	deps, _ := config.LoadDependencyModel(NewGraph())
+	deps := loadUnchanged(config)
 	if deps.DepList[0].fetch {
 		t.Errorf("Expected to not fetch the tag dependencies")
 	}
@@ -205,9 +266,7 @@ func TestFetchWithMixedSpecsIgnoringOrder(t *testing.T) {
   import = "github.com/calavera/testGoPack"
   commit = "182cae2ee3926a960223d8db4998aa9d57c89788"
 `)
-	config.WriteChecksum()
-
-	deps, _ := config.LoadDependencyModel(NewGraph())
+	deps := loadUnchanged(config)
 	if !deps.DepList[0].fetch {
 		t.Errorf("Expected to not fetch the commit dependencies")
 	}
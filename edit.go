@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Properties gp add can set, in the order they're written.
+var addProps = []string{"scm", "source", "sha256", "branch", "commit", "tag", "version"}
+
+// gp add <import> [--branch|--commit|--tag|--version spec] [--scm scm --source source]
+func addCommand(args []string) error {
+	flags := flag.NewFlagSet("add", flag.ContinueOnError)
+	values := make(map[string]*string)
+	for _, p := range addProps {
+		values[p] = flags.String(p, "", fmt.Sprintf("%s of the dependency", p))
+	}
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gp add <import> [--branch|--commit|--tag|--version spec] [--scm scm --source source]")
+		flags.PrintDefaults()
+	}
+
+	// flags may come before or after the import
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return &UsageError{}
+	}
+	importPath := flags.Arg(0)
+	if err := parseCommandFlags(flags, flags.Args()[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return &UsageError{}
+	}
+
+	props := make(map[string]string)
+	for p, v := range values {
+		if *v != "" {
+			props[p] = *v
+		}
+	}
+
+	config, err := NewConfig(pwd)
+	if err != nil {
+		return err
+	}
+	// the new dependency is fetched through the mirrors like the others
+	if err = config.setupMirrors(); err != nil {
+		return err
+	}
+	return addDependency(config, importPath, props)
+}
+
+// gp remove <import>
+func removeCommand(args []string) error {
+	if len(args) != 1 {
+		return &UsageError{"usage: gp remove <import>"}
+	}
+
+	config, err := NewConfig(pwd)
+	if err != nil {
+		return err
+	}
+	return removeDependency(config, args[0])
+}
+
+// Append a table for the import to the config and fetch it,
+// leaving the config as it was when the dependency can't be fetched.
+func addDependency(config *Config, importPath string, props map[string]string) error {
+	if _, found := config.depName(importPath); found {
+		return &UsageError{fmt.Sprintf("%s is already a dependency in %s", importPath, config.Path)}
+	}
+
+	names := make(map[string]bool)
+	if config.DepsTree != nil {
+		for _, k := range config.DepsTree.Keys() {
+			names[k] = true
+		}
+	}
+	name := initDepName(importPath, names)
+
+	table := depTable(name, importPath, props)
+	t, err := toml.Load(table)
+	if err != nil {
+		return err
+	}
+	d, err := config.loadDep(t.Get("deps." + name).(*toml.TomlTree))
+	if err != nil {
+		return &UsageError{err.Error()}
+	}
+
+	content, err := ioutil.ReadFile(config.Path)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(config.Path, appendTable(content, table), 0644); err != nil {
+		return err
+	}
+
+	d.Fetch(true)
+	if err = fetchDependency(d); err != nil {
+		ioutil.WriteFile(config.Path, content, 0644)
+		if e, ok := err.(*ScmError); ok {
+			err = e.Err
+		}
+		return &ScmError{importPath, fmt.Errorf("couldn't fetch it, %s is unchanged: %s", config.Path, err)}
+	}
+
+	fmtcolor(Green, "added %s to %s as deps.%s\n", importPath, config.Path, name)
+	return nil
+}
+
+// Drop the table of the import from the config, its vendored copy
+// and its lock entry. Comments and the other tables are kept as they are.
+func removeDependency(config *Config, importPath string) error {
+	name, found := config.depName(importPath)
+	if !found {
+		return &UsageError{fmt.Sprintf("%s is not a dependency in %s", importPath, config.Path)}
+	}
+
+	content, err := ioutil.ReadFile(config.Path)
+	if err != nil {
+		return err
+	}
+
+	edited, found := removeTable(content, "deps."+name)
+	if !found {
+		return &ConfigError{config.Path, fmt.Errorf("couldn't find the [deps.%s] table", name)}
+	}
+	if _, err = toml.Load(string(edited)); err != nil {
+		return &ConfigError{config.Path, fmt.Errorf("wouldn't parse without deps.%s: %s", name, err)}
+	}
+
+	if err = ioutil.WriteFile(config.Path, edited, 0644); err != nil {
+		return err
+	}
+
+	lock, err := LoadLock(pwd)
+	if err != nil {
+		return err
+	}
+	if _, locked := lock.Entries[importPath]; locked {
+		lock.Release(importPath)
+		if err = lock.Write(); err != nil {
+			return err
+		}
+	}
+
+	if err = pruneDependency(config, lock, importPath); err != nil {
+		return err
+	}
+
+	fmtcolor(Green, "removed %s from %s\n", importPath, config.Path)
+	return nil
+}
+
+// Delete the vendored copy of the import, but not the checkouts of the
+// dependencies left in the config or the lock that live under it.
+func pruneDependency(config *Config, lock *Lock, importPath string) error {
+	graph := NewGraph()
+	if config.Repository != "" {
+		graph.Insert(NewDependency(config.Repository))
+	}
+	if config.DepsTree != nil {
+		for _, k := range config.DepsTree.Keys() {
+			if i, ok := config.DepsTree.Get(k + ".import").(string); ok && i != importPath {
+				graph.Insert(NewDependency(i))
+			}
+		}
+	}
+	for i := range lock.Entries {
+		graph.Insert(NewDependency(i))
+	}
+
+	orphans, err := findOrphans(graph)
+	if err != nil {
+		return err
+	}
+	for _, orphan := range orphans {
+		if orphan != importPath && !strings.HasPrefix(orphan, importPath+"/") {
+			continue
+		}
+		fmtcolor(Gray, "pruning %s\n", dependencyPath(orphan))
+		if err = os.RemoveAll(dependencyPath(orphan)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The key of the dependency declaring the import.
+func (c *Config) depName(importPath string) (string, bool) {
+	if c.DepsTree == nil {
+		return "", false
+	}
+
+	for _, k := range c.DepsTree.Keys() {
+		if i, ok := c.DepsTree.Get(k + ".import").(string); ok && i == importPath {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+func depTable(name, importPath string, props map[string]string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[deps.%s]\n", name)
+	fmt.Fprintf(&buf, "import = %s\n", strconv.Quote(importPath))
+	for _, p := range addProps {
+		if v, found := props[p]; found {
+			fmt.Fprintf(&buf, "%s = %s\n", p, strconv.Quote(v))
+		}
+	}
+	return buf.String()
+}
+
+func appendTable(content []byte, table string) []byte {
+	s := strings.TrimRight(string(content), "\n")
+	if s != "" {
+		s = s + "\n\n"
+	}
+	return []byte(s + table)
+}
+
+// Remove a table and the comments right above its header.
+// Comments right above the next header belong to the next table.
+func removeTable(content []byte, table string) ([]byte, bool) {
+	lines := strings.Split(string(content), "\n")
+
+	start := -1
+	for i, l := range lines {
+		if tableName(l) == table {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return content, false
+	}
+
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if tableName(lines[i]) != "" {
+			end = i
+			break
+		}
+	}
+
+	// comments right below the table belong to it, the ones past
+	// a blank line to whatever comes next
+	last := end - 1
+	for last > start && (isComment(lines[last]) || strings.TrimSpace(lines[last]) == "") {
+		last--
+	}
+	i := last + 1
+	for i < end && isComment(lines[i]) {
+		i++
+	}
+	for ; i < end; i++ {
+		if isComment(lines[i]) {
+			end = i
+			break
+		}
+	}
+
+	for end > start+1 && isComment(lines[end-1]) {
+		end--
+	}
+	for start > 0 && isComment(lines[start-1]) {
+		start--
+	}
+
+	lines = append(lines[:start], lines[end:]...)
+	s := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if s != "" {
+		s = s + "\n"
+	}
+	return []byte(s), true
+}
+
+// The name of the table a header line opens, "deps.mux" for "[deps.mux]".
+func tableName(line string) string {
+	l := strings.TrimSpace(line)
+	if !strings.HasPrefix(l, "[") {
+		return ""
+	}
+
+	end := strings.Index(l, "]")
+	if end < 0 {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(l[:end], "[ "), ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+func isComment(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "#")
+}
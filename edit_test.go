@@ -0,0 +1,249 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+const editFixture = `# my project
+repo = "github.com/me/project"
+
+# the web toolkit
+[deps.mux]
+import = "github.com/gorilla/mux"
+tag = "1.0"
+
+# keep it on master
+[deps.lib]
+import = "github.com/me/lib"
+branch = "master"
+# tag = "v1.0"
+
+# configuration files
+[deps.toml]
+import = "github.com/pelletier/go-toml"
+commit = "23d36c08ab90f4957ae8e7d781907c368f5454dd"
+`
+
+func TestRemoveTable(t *testing.T) {
+	expected := map[string]string{
+		"deps.mux": `# my project
+repo = "github.com/me/project"
+
+# keep it on master
+[deps.lib]
+import = "github.com/me/lib"
+branch = "master"
+# tag = "v1.0"
+
+# configuration files
+[deps.toml]
+import = "github.com/pelletier/go-toml"
+commit = "23d36c08ab90f4957ae8e7d781907c368f5454dd"
+`,
+		"deps.lib": `# my project
+repo = "github.com/me/project"
+
+# the web toolkit
+[deps.mux]
+import = "github.com/gorilla/mux"
+tag = "1.0"
+
+# configuration files
+[deps.toml]
+import = "github.com/pelletier/go-toml"
+commit = "23d36c08ab90f4957ae8e7d781907c368f5454dd"
+`,
+		"deps.toml": `# my project
+repo = "github.com/me/project"
+
+# the web toolkit
+[deps.mux]
+import = "github.com/gorilla/mux"
+tag = "1.0"
+
+# keep it on master
+[deps.lib]
+import = "github.com/me/lib"
+branch = "master"
+# tag = "v1.0"
+`,
+	}
+
+	for table, config := range expected {
+		edited, found := removeTable([]byte(editFixture), table)
+		if !found {
+			t.Errorf("Expected to find %s", table)
+		}
+		if string(edited) != config {
+			t.Errorf("Unexpected config without %s:\n%s", table, edited)
+		}
+	}
+
+	if _, found := removeTable([]byte(editFixture), "deps.missing"); found {
+		t.Errorf("Expected not to find deps.missing")
+	}
+}
+
+func TestRemoveTableKeepsCommentsOfTheNextTable(t *testing.T) {
+	config := `[deps.mux]
+import = "github.com/gorilla/mux"
+
+# configuration files
+# pinned until v2 is out
+
+[deps.toml]
+import = "github.com/pelletier/go-toml"
+`
+	expected := `# configuration files
+# pinned until v2 is out
+
+[deps.toml]
+import = "github.com/pelletier/go-toml"
+`
+
+	if edited, _ := removeTable([]byte(config), "deps.mux"); string(edited) != expected {
+		t.Errorf("Expected the comments of deps.toml to be kept:\n%s", edited)
+	}
+}
+
+func TestAddDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, editFixture)
+
+	repo := createGitRepo(t, "newlib")
+	commitGitFile(t, repo, "lib.go", "package newlib\n")
+
+	config := loadTestConfig(pwd)
+	err := addDependency(config, "example.com/newlib", map[string]string{"scm": "git", "source": repo, "branch": "master"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := ioutil.ReadFile(config.Path)
+	if !strings.HasPrefix(string(content), editFixture) {
+		t.Errorf("Expected the config to be kept as it was:\n%s", content)
+	}
+	if !strings.HasSuffix(string(content), "\n[deps.newlib]\nimport = \"example.com/newlib\"\nscm = \"git\"\nsource = \""+repo+"\"\nbranch = \"master\"\n") {
+		t.Errorf("Expected newlib to be added:\n%s", content)
+	}
+
+	if _, err := os.Stat(dependencyPath("example.com/newlib") + "/lib.go"); err != nil {
+		t.Errorf("Expected newlib to be fetched")
+	}
+
+	if err := addDependency(loadTestConfig(pwd), "example.com/newlib", map[string]string{"branch": "master"}); err == nil {
+		t.Errorf("Expected adding newlib twice to fail")
+	}
+}
+
+func TestAddInvalidDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, editFixture)
+
+	invalid := []map[string]string{
+		{"tag": "1.0", "branch": "master"},
+		{"scm": "git", "branch": "master"},
+		{"version": "not a version"},
+	}
+
+	for _, props := range invalid {
+		config := loadTestConfig(pwd)
+		if err := addDependency(config, "example.com/newlib", props); err == nil {
+			t.Errorf("Expected %v to be invalid", props)
+		}
+
+		content, _ := ioutil.ReadFile(config.Path)
+		if string(content) != editFixture {
+			t.Errorf("Expected an invalid dependency to leave the config unchanged:\n%s", content)
+		}
+	}
+}
+
+func TestAddUnreachableDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, editFixture)
+
+	config := loadTestConfig(pwd)
+	err := addDependency(config, "example.com/newlib", map[string]string{"scm": "git", "source": pwd + "/missing", "branch": "master"})
+	if err == nil {
+		t.Fatal("Expected a dependency that can't be fetched to fail")
+	}
+
+	content, _ := ioutil.ReadFile(config.Path)
+	if string(content) != editFixture {
+		t.Errorf("Expected the config to be restored:\n%s", content)
+	}
+}
+
+func TestRemoveKeepsNestedCheckouts(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, `
+[deps.lib]
+import = "github.com/me/lib"
+
+[deps.sub]
+import = "github.com/me/lib/sub"
+`)
+
+	createPath(dependencyPath("github.com/me/lib/sub"))
+	check(ioutil.WriteFile(path.Join(dependencyPath("github.com/me/lib"), "lib.go"), []byte("package lib\n"), 0644))
+	check(ioutil.WriteFile(path.Join(dependencyPath("github.com/me/lib/sub"), "sub.go"), []byte("package sub\n"), 0644))
+
+	if err := removeDependency(loadTestConfig(pwd), "github.com/me/lib"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path.Join(dependencyPath("github.com/me/lib"), "lib.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected the vendored copy of github.com/me/lib to be pruned")
+	}
+	if _, err := os.Stat(path.Join(dependencyPath("github.com/me/lib/sub"), "sub.go")); err != nil {
+		t.Errorf("Expected the checkout of github.com/me/lib/sub to be kept: %s", err)
+	}
+}
+
+func TestRemoveDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, editFixture)
+
+	vendored := dependencyPath("github.com/me/lib")
+	createPath(vendored)
+
+	lock := NewLock(pwd)
+	lock.Entries["github.com/me/lib"] = &LockEntry{Import: "github.com/me/lib", Scm: "go", CheckoutType: "branch", CheckoutSpec: "master", Revision: "abc"}
+	lock.Entries["github.com/gorilla/mux"] = &LockEntry{Import: "github.com/gorilla/mux", Scm: "go", CheckoutType: "tag", CheckoutSpec: "1.0", Revision: "def"}
+	check(lock.Write())
+
+	config := loadTestConfig(pwd)
+	if err := removeDependency(config, "github.com/me/lib"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found := loadTestConfig(pwd).depName("github.com/me/lib"); found {
+		t.Errorf("Expected github.com/me/lib to be removed from the config")
+	}
+
+	if _, err := os.Stat(vendored); !os.IsNotExist(err) {
+		t.Errorf("Expected the vendored copy to be pruned")
+	}
+
+	lock, _ = LoadLock(pwd)
+	if _, found := lock.Entries["github.com/me/lib"]; found {
+		t.Errorf("Expected the lock entry to be released")
+	}
+	if _, found := lock.Entries["github.com/gorilla/mux"]; !found {
+		t.Errorf("Expected other lock entries to be kept")
+	}
+
+	if err := removeDependency(loadTestConfig(pwd), "github.com/me/lib"); err == nil {
+		t.Errorf("Expected removing a missing dependency to fail")
+	}
+}
@@ -1,31 +1,213 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"go/token"
+	"strings"
 )
 
+// Exit codes of gp. They're stable, scripts can rely on them.
 const (
-	UnusedDep       = "unused-dep"
-	UnmanagedImport = "unmanaged-import"
+	ExitOK = 0
+	// any other error, like the go tool failing
+	ExitError = 1
+	// gp was called with the wrong arguments
+	ExitUsage = 2
+	// gopack.config, gopack.lock or ~/.gopackrc are invalid
+	ExitConfig = 3
+	// a dependency couldn't be fetched or checked out
+	ExitScm = 4
+	// problems found in the project, like unmanaged imports
+	ExitValidation = 5
 )
 
+const (
+	UnusedDep        = "unused-dep"
+	UnmanagedImport  = "unmanaged-import"
+	VersionConflict  = "version-conflict"
+	MissingDep       = "missing-dep"
+	FetchFailed      = "fetch-failed"
+	DependencyCycle  = "dependency-cycle"
+	ModifiedDep      = "modified-dep"
+	RevisionMismatch = "revision-mismatch"
+)
+
+// ConfigError means a config file gopack reads can't be
+// parsed or declares something invalid.
+type ConfigError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	msg := strings.TrimSpace(e.Err.Error())
+	if strings.HasPrefix(msg, e.Path) {
+		return msg
+	}
+	return fmt.Sprintf("%s - %s", e.Path, msg)
+}
+
+// ScmError means the scm of a dependency failed.
+type ScmError struct {
+	Import string
+	Err    error
+}
+
+func (e *ScmError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Import, e.Err)
+}
+
+// ValidationError holds the problems found in the project
+// that stop gopack from going on.
+type ValidationError struct {
+	Errors []*ProjectError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := []string{}
+	for _, p := range e.Errors {
+		msgs = append(msgs, strings.TrimSpace(p.Message))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// A ValidationError for the problems, nil if there's none.
+func validationError(errors []*ProjectError) error {
+	if len(errors) == 0 {
+		return nil
+	}
+	return &ValidationError{errors}
+}
+
+// The config has no dependencies for the command to work on.
+func NoDependenciesError(config *Config) error {
+	return &ConfigError{config.Path, fmt.Errorf("no dependencies to load")}
+}
+
+// UsageError means gp was called with the wrong arguments.
+// Its message is empty when the usage was printed already.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// The exit code of gp when it stops on err, see ExitOK and friends.
+func ExitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return ExitOK
+	case *UsageError:
+		return ExitUsage
+	case *ConfigError:
+		return ExitConfig
+	case *ScmError:
+		return ExitScm
+	case *ValidationError:
+		for _, p := range e.Errors {
+			if p.Kind == FetchFailed {
+				return ExitScm
+			}
+		}
+		return ExitValidation
+	}
+	return ExitError
+}
+
+// Report err like the problems of the project, so that JSON
+// output always has the same shape.
+func asProjectErrors(err error) []*ProjectError {
+	kind := "error"
+	switch e := err.(type) {
+	case *ValidationError:
+		return e.Errors
+	case *ProjectError:
+		return []*ProjectError{e}
+	case *ConfigError:
+		kind = "config-error"
+	case *ScmError:
+		return []*ProjectError{{Kind: "scm-error", Import: e.Import, Message: e.Error()}}
+	}
+	return []*ProjectError{{Kind: kind, Message: err.Error()}}
+}
+
 type ProjectError struct {
-	Kind    string
+	Kind string
+	// the import the problem is about
+	Import  string
 	Message string
+	// where in the source the problem shows up, if anywhere
+	Positions []token.Position
 }
 
 func UnusedDependencyError(importPath string) *ProjectError {
 	return &ProjectError{
-		UnusedDep,
-		fmt.Sprintf("%s in gopack.config is unused\n", importPath),
+		Kind:    UnusedDep,
+		Import:  importPath,
+		Message: fmt.Sprintf("%s in gopack.config is unused\n", importPath),
 	}
 }
 
 func UnmanagedImportError(s *ImportStats) *ProjectError {
 	msg := fmt.Sprintf("%s referenced in the following locations but not managed in gopack.config\n%s", s.Path, s.ReferenceList())
 	return &ProjectError{
-		UnmanagedImport,
-		msg,
+		Kind:      UnmanagedImport,
+		Import:    s.Path,
+		Message:   msg,
+		Positions: s.ReferencePositions,
+	}
+}
+
+func VersionConflictError(c *Conflict) *ProjectError {
+	msg := fmt.Sprintf("%s requested with different versions, using %s requested by %s and ignoring %s requested by %s\n",
+		c.Kept.Import, c.Kept.Version(), c.Kept.Origin, c.Ignored.Version(), c.Ignored.Origin)
+	return &ProjectError{
+		Kind:    VersionConflict,
+		Import:  c.Kept.Import,
+		Message: msg,
+	}
+}
+
+func DependencyCycleError(cycle []string) *ProjectError {
+	return &ProjectError{
+		Kind:    DependencyCycle,
+		Import:  cycle[0],
+		Message: fmt.Sprintf("dependency cycle %s\n", strings.Join(cycle, " -> ")),
+	}
+}
+
+func MissingDependencyError(d *Dep, reason string) *ProjectError {
+	return &ProjectError{
+		Kind:    MissingDep,
+		Import:  d.Import,
+		Message: fmt.Sprintf("%s %s\n", d.Import, reason),
+	}
+}
+
+// A problem gp verify found with the checkout of the dep.
+func VerifyError(d *Dep, kind, reason string) *ProjectError {
+	return &ProjectError{
+		Kind:    kind,
+		Import:  d.Import,
+		Message: fmt.Sprintf("%s %s\n", d.Import, reason),
+	}
+}
+
+// Wrap an error fetching the dep, unless it's already a project error.
+func FetchError(d *Dep, err error) *ProjectError {
+	switch e := err.(type) {
+	case *ProjectError:
+		return e
+	case *ScmError:
+		err = e.Err
+	}
+	return &ProjectError{
+		Kind:    FetchFailed,
+		Import:  d.Import,
+		Message: fmt.Sprintf("error fetching %s: %s\n", d.Import, err),
 	}
 }
 
@@ -36,3 +218,23 @@ func (e *ProjectError) String() string {
 func (e *ProjectError) Error() string {
 	return e.String()
 }
+
+func (e *ProjectError) MarshalJSON() ([]byte, error) {
+	type position struct {
+		Filename string `json:"filename"`
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+	}
+
+	positions := []position{}
+	for _, p := range e.Positions {
+		positions = append(positions, position{p.Filename, p.Line, p.Column})
+	}
+
+	return json.Marshal(struct {
+		Kind      string     `json:"kind"`
+		Import    string     `json:"import,omitempty"`
+		Message   string     `json:"message"`
+		Positions []position `json:"positions"`
+	}{e.Kind, e.Import, strings.TrimSpace(e.Message), positions})
+}
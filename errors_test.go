@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, ExitOK},
+		{fmt.Errorf("exit status 2"), ExitError},
+		{&UsageError{}, ExitUsage},
+		{&ConfigError{"gopack.config", fmt.Errorf("bad")}, ExitConfig},
+		{&ScmError{"example.com/lib", fmt.Errorf("bad")}, ExitScm},
+		{&ValidationError{[]*ProjectError{UnusedDependencyError("example.com/lib")}}, ExitValidation},
+		{&ValidationError{[]*ProjectError{FetchError(NewDependency("example.com/lib"), fmt.Errorf("bad"))}}, ExitScm},
+	}
+
+	for _, test := range tests {
+		if code := ExitCode(test.err); code != test.code {
+			t.Errorf("Expected exit code %d for %#v but it was %d", test.code, test.err, code)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	fixtures := []string{
+		`[deps.lib`,
+		`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  tag = "v1.0.0"
+`,
+		`
+[mirrors.github]
+  prefix = "github.com/"
+`,
+	}
+
+	for _, fixture := range fixtures {
+		setupTestPwd()
+		setupEnv()
+		createFixtureConfig(pwd, fixture)
+
+		_, _, err := loadConfiguration(pwd)
+		if e, ok := err.(*ConfigError); !ok || e.Path != filepath.Join(pwd, "gopack.config") {
+			t.Errorf("Expected a config error for gopack.config but it was %#v - %s", err, fixture)
+		}
+	}
+}
+
+func TestLockError(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, `
+[deps.lib]
+  import = "example.com/lib"
+`)
+	check(ioutil.WriteFile(filepath.Join(pwd, GopackLock), []byte("[deps.lib]\nrevision = \"abc\"\n"), 0644))
+
+	_, _, err := loadConfiguration(pwd)
+	if e, ok := err.(*ConfigError); !ok || e.Path != filepath.Join(pwd, GopackLock) {
+		t.Errorf("Expected a config error for gopack.lock but it was %#v", err)
+	}
+}
+
+func TestFetchErrorExitCode(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s/missing"
+`, pwd))
+
+	_, deps := loadTestConfiguration(pwd)
+	err := loadTransitiveDependencies(deps)
+	if e, ok := err.(*ValidationError); !ok || len(e.Errors) != 1 || e.Errors[0].Kind != FetchFailed {
+		t.Fatalf("Expected the dependency to fail to fetch but it was %#v", err)
+	}
+	if code := ExitCode(err); code != ExitScm {
+		t.Errorf("Expected exit code %d but it was %d", ExitScm, code)
+	}
+}
+
+func TestCheckoutErrorExitCode(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	createGitProject(repo, `tag = "v1.0.0"`)
+
+	_, deps := loadTestConfiguration(pwd)
+	err := loadTransitiveDependencies(deps)
+	if code := ExitCode(err); code != ExitScm {
+		t.Errorf("Expected exit code %d for a tag that can't be checked out but it was %d - %v", ExitScm, code, err)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	defer func() { format, jobs = TextFormat, DefaultJobs }()
+
+	for _, args := range [][]string{{}, {"-j", "0", "build"}, {"-format", "dot", "stats"}, {"-unknown", "build"}} {
+		if err := gopack(args); ExitCode(err) != ExitUsage {
+			t.Errorf("Expected a usage error for %v but it was %#v", args, err)
+		}
+	}
+}
+
+func TestInstallError(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	dependencies := &Dependencies{ImportGraph: NewGraph()}
+	dependencies.ImportGraph.Insert(NewDependency("example.com/missing"))
+
+	err := dependencies.Install("")
+	if err == nil {
+		t.Fatal("Expected installing a missing package to fail")
+	}
+	if code := ExitCode(err); code != ExitError {
+		t.Errorf("Expected exit code %d but it was %d", ExitError, code)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The project as the root of the exported graph.
+func (d *Dependencies) rootName() string {
+	if d.Config != nil && d.Config.Repository != "" {
+		return d.Config.Repository
+	}
+	return filepath.Base(pwd)
+}
+
+// The resolved dependencies and the edges between them, sorted
+// so that the same graph is exported the same way every time.
+func (d *Dependencies) exportGraph() ([]*Dep, []*Edge) {
+	deps := d.Resolved()
+	sort.Sort(byImport(deps))
+
+	// the edges from the root config come first, their parent is ""
+	sorted := &exportedEdges{edges: d.ImportGraph.RequirementList()}
+	for i := range sorted.edges {
+		sorted.order = append(sorted.order, i)
+	}
+	sort.Sort(sorted)
+	return deps, sorted.edges
+}
+
+type byImport []*Dep
+
+func (s byImport) Len() int           { return len(s) }
+func (s byImport) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byImport) Less(i, j int) bool { return s[i].Import < s[j].Import }
+
+// Sorts edges by parent and then by dependency, keeping
+// the order of the requirement list for duplicates.
+type exportedEdges struct {
+	edges []*Edge
+	order []int
+}
+
+func (s *exportedEdges) Len() int { return len(s.edges) }
+
+func (s *exportedEdges) Swap(i, j int) {
+	s.edges[i], s.edges[j] = s.edges[j], s.edges[i]
+	s.order[i], s.order[j] = s.order[j], s.order[i]
+}
+
+func (s *exportedEdges) Less(i, j int) bool {
+	a, b := s.edges[i], s.edges[j]
+	if a.Parent != b.Parent {
+		return a.Parent < b.Parent
+	}
+	if a.Dep.Import != b.Dep.Import {
+		return a.Dep.Import < b.Dep.Import
+	}
+	return s.order[i] < s.order[j]
+}
+
+// Whether the import is the project itself, which dependencies
+// can require back.
+func (d *Dependencies) isRoot(importPath string) bool {
+	return importPath == "" || d.Config != nil && importPath == d.Config.Repository
+}
+
+// What's written next to an edge, the version its config asks for.
+func (d *Dependencies) edgeLabel(edge *Edge) (label string, ignored bool) {
+	if d.keptInstead(edge.Dep) != nil {
+		return edge.Dep.Spec() + " (ignored)", true
+	}
+	return edge.Dep.Spec(), false
+}
+
+// Render the resolved dependencies and what requires them in
+// the Graphviz dot language, `gp graph | dot -Tsvg > deps.svg`.
+// Edges asking for a version that lost a conflict are dashed.
+func (d *Dependencies) WriteDot(w io.Writer) {
+	root := d.rootName()
+	deps, edges := d.exportGraph()
+
+	fmt.Fprintln(w, "digraph dependencies {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	fmt.Fprintln(w, "  node [shape=box];")
+	fmt.Fprintf(w, "  %q [style=bold];\n", root)
+
+	for _, dep := range deps {
+		fmt.Fprintf(w, "  %q;\n", dep.Import)
+	}
+
+	for _, edge := range edges {
+		parent := edge.Parent
+		if parent == "" {
+			parent = root
+		}
+
+		label, ignored := d.edgeLabel(edge)
+		style := ""
+		if ignored {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "  %q -> %q [label=%q%s];\n", parent, edge.Dep.Import, label, style)
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+// Render the same graph as a Mermaid flowchart, which markdown
+// renderers like GitHub's draw in ```mermaid blocks.
+func (d *Dependencies) WriteMermaid(w io.Writer) {
+	deps, edges := d.exportGraph()
+
+	ids := make(map[string]string)
+	id := func(importPath string) string {
+		if d.isRoot(importPath) {
+			importPath = ""
+		}
+		if _, found := ids[importPath]; !found {
+			ids[importPath] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[importPath]
+	}
+
+	fmt.Fprintln(w, "graph LR")
+	fmt.Fprintf(w, "  %s[\"%s\"]\n", id(""), mermaidEscape(d.rootName()))
+	for _, dep := range deps {
+		fmt.Fprintf(w, "  %s[\"%s\"]\n", id(dep.Import), mermaidEscape(dep.Import))
+	}
+
+	for _, edge := range edges {
+		label, ignored := d.edgeLabel(edge)
+		arrow := "-->"
+		if ignored {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "  %s %s|\"%s\"| %s\n", id(edge.Parent), arrow, mermaidEscape(label), id(edge.Dep.Import))
+	}
+}
+
+func mermaidEscape(s string) string {
+	return strings.Replace(s, `"`, "#quot;", -1)
+}
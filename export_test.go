@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// example.com/app requires lib and shared at v1.1,
+// lib requires shared at v1.0, which is ignored.
+func exportFixture() *Dependencies {
+	graph := NewGraph()
+	require := func(parent, importPath, tag string) {
+		d := &Dep{Import: importPath, Scm: GitTag, CheckoutFlag: TagFlag, CheckoutSpec: tag}
+		graph.Require(parent, d)
+		graph.Insert(d)
+	}
+
+	require("", "example.com/lib", "v2.0")
+	require("", "example.com/shared", "v1.1")
+	require("example.com/lib", "example.com/shared", "v1.0")
+
+	return &Dependencies{ImportGraph: graph, Config: &Config{Repository: "example.com/app"}}
+}
+
+func TestWriteDot(t *testing.T) {
+	var buf bytes.Buffer
+	exportFixture().WriteDot(&buf)
+
+	expected := `digraph dependencies {
+  rankdir=LR;
+  node [shape=box];
+  "example.com/app" [style=bold];
+  "example.com/lib";
+  "example.com/shared";
+  "example.com/app" -> "example.com/lib" [label="tag v2.0"];
+  "example.com/app" -> "example.com/shared" [label="tag v1.1"];
+  "example.com/lib" -> "example.com/shared" [label="tag v1.0 (ignored)", style=dashed];
+}
+`
+	if buf.String() != expected {
+		t.Errorf("Expected the dot graph\n%s\nbut it was\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var buf bytes.Buffer
+	exportFixture().WriteMermaid(&buf)
+
+	expected := `graph LR
+  n0["example.com/app"]
+  n1["example.com/lib"]
+  n2["example.com/shared"]
+  n0 -->|"tag v2.0"| n1
+  n0 -->|"tag v1.1"| n2
+  n1 -.->|"tag v1.0 (ignored)"| n2
+`
+	if buf.String() != expected {
+		t.Errorf("Expected the mermaid graph\n%s\nbut it was\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMermaidRequiringTheProject(t *testing.T) {
+	d := exportFixture()
+	back := &Dep{Import: "example.com/app", Scm: GitTag, CheckoutFlag: BranchFlag, CheckoutSpec: "master"}
+	d.ImportGraph.Require("example.com/shared", back)
+	d.ImportGraph.Insert(back)
+
+	var buf bytes.Buffer
+	d.WriteMermaid(&buf)
+
+	expected := `graph LR
+  n0["example.com/app"]
+  n1["example.com/lib"]
+  n2["example.com/shared"]
+  n0 -->|"tag v2.0"| n1
+  n0 -->|"tag v1.1"| n2
+  n1 -.->|"tag v1.0 (ignored)"| n2
+  n2 -->|"branch master"| n0
+`
+	if buf.String() != expected {
+		t.Errorf("Expected the edge back to the project to point at its node\n%s\nbut it was\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Fingerprints of the dependencies resolved by the last run, by import.
+// A dependency is fetched again only when its fingerprint changes, so
+// editing one table of a config, or the config of a dependency, only
+// refetches the dependencies it affects.
+type Fingerprints map[string]string
+
+func fingerprintsPath() string {
+	return filepath.Join(pwd, GopackFingerprints)
+}
+
+// LoadFingerprints reads the fingerprints written by the last run,
+// none at all on the first one.
+func LoadFingerprints() (Fingerprints, error) {
+	fingerprints := Fingerprints{}
+
+	f, err := os.Open(fingerprintsPath())
+	if os.IsNotExist(err) {
+		return fingerprints, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 {
+			fingerprints[fields[0]] = fields[1]
+		}
+	}
+	return fingerprints, scanner.Err()
+}
+
+// Whether what the dep resolves to changed since the last run,
+// or its checkout is gone and it has to be fetched again anyway.
+func (f Fingerprints) Changed(d *Dep) bool {
+	if _, err := os.Stat(d.Src()); err != nil {
+		return true
+	}
+	return f[d.Import] != d.Fingerprint()
+}
+
+// Record the fingerprints of the resolved deps, pinned by the lock
+// like the next run will find them.
+func (c *Config) WriteFingerprints(deps *Dependencies) error {
+	lines := []string{}
+	for _, d := range deps.Resolved() {
+		pinned := *d
+		pinned.Revision = ""
+		c.Lock.Pin(&pinned)
+		lines = append(lines, fmt.Sprintf("%s %s\n", d.Import, pinned.Fingerprint()))
+	}
+	sort.Strings(lines)
+
+	os.MkdirAll(filepath.Join(pwd, GopackDir), 0755)
+	return ioutil.WriteFile(fingerprintsPath(), []byte(strings.Join(lines, "")), 0644)
+}
+
+// Hash of everything the dep resolves to once every config, replace
+// rule and the lock were applied. Formatting and comments of the
+// configs don't change it, and neither do mirrors, which only change
+// where the same code is downloaded from.
+func (d *Dep) Fingerprint() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "import %s\n", d.Import)
+	fmt.Fprintf(h, "scm %s\n", d.Scm)
+	fmt.Fprintf(h, "source %s\n", d.Source)
+	fmt.Fprintf(h, "%s %s\n", d.CheckoutType(), d.CheckoutSpec)
+	fmt.Fprintf(h, "sha256 %s\n", d.Sha256)
+	fmt.Fprintf(h, "revision %s\n", d.Revision)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"strings"
+)
+
+// Lines of unchanged config printed around every change.
+const diffContext = 2
+
+// Fix the validation errors gopack knows how to fix: unmanaged remote
+// imports get a table pinned to the revision found on disk and unused
+// tables are removed. The change is printed as a diff before writing it.
+func fixProject(p *ProjectStats, gopath string) error {
+	importGraph := NewGraph()
+	config, err := NewConfig(pwd)
+	if err != nil {
+		return err
+	}
+	if err = config.InitRepo(importGraph); err != nil {
+		return err
+	}
+
+	dependencies, err := config.LoadDependencyModel(importGraph)
+	if err != nil {
+		return err
+	}
+	if dependencies == nil {
+		dependencies = &Dependencies{ImportGraph: importGraph}
+	}
+
+	content, err := ioutil.ReadFile(config.Path)
+	if err != nil {
+		return err
+	}
+
+	fixed, err := fixConfig(config, content, dependencies.Validate(p), gopathDirs(gopath))
+	if err != nil {
+		return err
+	}
+
+	if string(fixed) == string(content) {
+		fmtcolor(Green, "nothing to fix in %s\n", config.Path)
+		return nil
+	}
+
+	printDiff(config.Path, strings.Split(string(content), "\n"), strings.Split(string(fixed), "\n"))
+	return ioutil.WriteFile(config.Path, fixed, 0644)
+}
+
+// Apply the fixes for errors to the config content.
+func fixConfig(config *Config, content []byte, errors []*ProjectError, dirs []string) ([]byte, error) {
+	unmanaged := []string{}
+
+	for _, e := range errors {
+		switch e.Kind {
+		case UnusedDep:
+			name, found := config.depName(e.Import)
+			if !found {
+				continue
+			}
+			fmtcolor(Gray, "removing unused %s\n", e.Import)
+			content, _ = removeTable(content, "deps."+name)
+		case UnmanagedImport:
+			unmanaged = append(unmanaged, e.Import)
+		}
+	}
+
+	names := make(map[string]bool)
+	if config.DepsTree != nil {
+		for _, k := range config.DepsTree.Keys() {
+			names[k] = true
+		}
+	}
+
+	for _, d := range findInitDependencies(unmanaged, dirs, names) {
+		if d.Commit == "" {
+			fmtcolor(Yellow, "adding %s, no copy was found to pin it\n", d.Import)
+		} else {
+			fmtcolor(Gray, "adding %s at commit %s\n", d.Import, shortRevision(d.Commit))
+		}
+		content = appendTable(content, d.Table())
+	}
+
+	if _, err := toml.Load(string(content)); err != nil {
+		return nil, &ConfigError{config.Path, fmt.Errorf("the fixed config wouldn't parse: %s", err)}
+	}
+	return content, nil
+}
+
+// Print the lines removed from and added to a file, diff -u style.
+func printDiff(name string, a, b []string) {
+	ops := diffLines(a, b)
+
+	fmtcolor(Blue, "--- %s\n+++ %s\n", name, name)
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+
+		// print the whole hunk at once, with context around every change
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j <= end+2*diffContext; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		end += diffContext
+		if end >= len(ops) {
+			end = len(ops) - 1
+		}
+
+		fmtcolor(Blue, "@@ line %d @@\n", ops[start].line+1)
+		for _, op := range ops[start : end+1] {
+			switch op.kind {
+			case '-':
+				fmtcolor(Red, "-%s\n", op.text)
+			case '+':
+				fmtcolor(Green, "+%s\n", op.text)
+			default:
+				fmt.Fprintf(output, " %s\n", op.text)
+			}
+		}
+		i = end
+	}
+}
+
+type diffOp struct {
+	kind byte
+	text string
+	// line of the text in the old file
+	line int
+}
+
+// Line diff of a and b through their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			ops = append(ops, diffOp{'+', b[j], i})
+			j++
+		default:
+			ops = append(ops, diffOp{'-', a[i], i})
+			i++
+		}
+	}
+	return ops
+}
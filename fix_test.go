@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFixConfig(t *testing.T) {
+	gopath, revision := setupInitProject(t)
+	createFixtureConfig(pwd, `# my project
+
+[deps.unused]
+import = "github.com/me/unused"
+tag = "1.0"
+`)
+
+	p, err := AnalyzeSourceTree(pwd)
+	check(err)
+
+	importGraph := NewGraph()
+	config := loadTestConfig(pwd)
+	dependencies, err := config.LoadDependencyModel(importGraph)
+	check(err)
+
+	content, _ := ioutil.ReadFile(config.Path)
+	fixed, err := fixConfig(config, content, dependencies.Validate(p), []string{gopath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# my project
+
+[deps.lib]
+import = "github.com/me/lib"
+commit = "` + revision + `"
+
+[deps.missing]
+import = "github.com/someone/missing"
+# no copy was found to pin, set a branch, commit, tag or version
+`
+	if string(fixed) != expected {
+		t.Errorf("Unexpected fixed config:\n%s", fixed)
+	}
+}
+
+func TestFixConfigWithoutErrors(t *testing.T) {
+	setupTestPwd()
+	content := []byte(editFixture)
+	createFixtureConfig(pwd, editFixture)
+
+	fixed, err := fixConfig(loadTestConfig(pwd), content, []*ProjectError{}, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(fixed) != editFixture {
+		t.Errorf("Expected the config to be unchanged:\n%s", fixed)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a := strings.Split("a\nb\nc\nd", "\n")
+	b := strings.Split("a\nc\nd\ne", "\n")
+
+	diff := []string{}
+	for _, op := range diffLines(a, b) {
+		diff = append(diff, string(op.kind)+op.text)
+	}
+
+	if strings.Join(diff, ",") != " a,-b, c, d,+e" {
+		t.Errorf("Unexpected diff %v", diff)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +30,7 @@ func TestUnmanagedImport(t *testing.T) {
 }
 
 func findErrors(dir string, t *testing.T) []*ProjectError {
-	c := NewConfig(dir)
+	c := loadTestConfig(dir)
 	d, err := c.LoadDependencyModel(NewGraph())
 	p, err := AnalyzeSourceTree(dir)
 	if err != nil {
@@ -44,3 +46,31 @@ func PrintErrors(errors []*ProjectError, t *testing.T) {
 		t.Logf("%s\n", e.String())
 	}
 }
+
+func TestProjectErrorJSON(t *testing.T) {
+	errors := findErrors(fmt.Sprintf("%s/unmanaged-import", GopackTestProjects), t)
+
+	b, err := json.Marshal(errors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var e struct {
+		Kind      string
+		Message   string
+		Positions []struct {
+			Filename string
+			Line     int
+		}
+	}
+	json.Unmarshal(b, &e)
+
+	if e.Kind != UnmanagedImport || e.Message == "" {
+		t.Errorf("Expected kind and message in %s", b)
+	}
+
+	if len(e.Positions) != 1 || e.Positions[0].Line == 0 ||
+		!strings.HasSuffix(e.Positions[0].Filename, "main.go") {
+		t.Errorf("Expected the position of the unmanaged import in %s", b)
+	}
+}
@@ -8,6 +8,29 @@ import (
 type Graph struct {
 	Nodes map[string]*Node
 	Leafs *list.List
+	// Declarations that lost against an earlier one for the same import.
+	Conflicts []*Conflict
+	// What every dependency requires, by import of the dependency
+	// whose config declared it, "" for the root config.
+	Edges map[string][]*Edge
+	// Import of the project, which nothing conflicts with.
+	Root string
+}
+
+// An Edge is a dependency as its parent's config declared it,
+// which may not be the version resolved in the graph.
+type Edge struct {
+	Parent string `json:"parent"`
+	Dep    *Dep   `json:"dependency"`
+}
+
+// A Conflict happens when two configs ask for different
+// versions of the same import. The first declaration
+// inserted in the graph is kept, so the root config
+// always wins over transitive ones.
+type Conflict struct {
+	Kept    *Dep
+	Ignored *Dep
 }
 
 type Node struct {
@@ -20,12 +43,108 @@ type Node struct {
 func NewGraph() *Graph {
 	return &Graph{
 		Nodes: make(map[string]*Node),
-		Leafs: list.New()}
+		Leafs: list.New(),
+		Edges: make(map[string][]*Edge)}
 }
 
-func (graph *Graph) Insert(dependency *Dep) {
+// Insert the dependency in the graph unless its import was already
+// declared, in which case the existing declaration is kept and a
+// conflict is recorded if versions differ. Returns whether the
+// dependency was inserted.
+func (graph *Graph) Insert(dependency *Dep) bool {
+	if node := graph.Lookup(dependency.Import); node != nil && node.Dependency != nil {
+		// configs requiring the project back get the project itself
+		if dependency.Import != graph.Root && !node.Dependency.SameVersion(dependency) {
+			graph.Conflicts = append(graph.Conflicts, &Conflict{node.Dependency, dependency})
+		}
+		return false
+	}
+
 	keys := strings.Split(dependency.Import, "/")
 	graph.Nodes[keys[0]] = graph.deepInsert(graph.Nodes, keys, dependency)
+	return true
+}
+
+// Record that the config of parent declared the dependency.
+func (graph *Graph) Require(parent string, dependency *Dep) {
+	graph.Edges[parent] = append(graph.Edges[parent], &Edge{parent, dependency})
+}
+
+// The edges from parent, in the order its config declares them.
+func (graph *Graph) Requirements(parent string) []*Edge {
+	return graph.Edges[parent]
+}
+
+// Every edge reachable from the root config, breadth first.
+func (graph *Graph) RequirementList() []*Edge {
+	edges := []*Edge{}
+	seen := map[string]bool{"": true}
+
+	for parents := []string{""}; len(parents) > 0; {
+		next := []string{}
+		for _, parent := range parents {
+			for _, edge := range graph.Requirements(parent) {
+				edges = append(edges, edge)
+				if !seen[edge.Dep.Import] {
+					seen[edge.Dep.Import] = true
+					next = append(next, edge.Dep.Import)
+				}
+			}
+		}
+		parents = next
+	}
+	return edges
+}
+
+// The cycles in the requirements, each one as the imports along it
+// ending with the import it starts from. root is the import of the
+// project, whose requirements are under "", so dependencies requiring
+// the project back are cycles too.
+func (graph *Graph) Cycles(root string) [][]string {
+	cycles := [][]string{}
+	path := []string{}
+	// where the imports on the path are in it
+	position := make(map[string]int)
+	done := make(map[string]bool)
+
+	key := func(importPath string) string {
+		if importPath == root {
+			return ""
+		}
+		return importPath
+	}
+	name := func(k string) string {
+		if k == "" {
+			return root
+		}
+		return k
+	}
+
+	var visit func(k string)
+	visit = func(k string) {
+		position[k] = len(path)
+		path = append(path, k)
+
+		for _, edge := range graph.Requirements(k) {
+			child := key(edge.Dep.Import)
+			if i, found := position[child]; found {
+				cycle := []string{}
+				for _, p := range path[i:] {
+					cycle = append(cycle, name(p))
+				}
+				cycles = append(cycles, append(cycle, name(child)))
+			} else if !done[child] {
+				visit(child)
+			}
+		}
+
+		delete(position, k)
+		done[k] = true
+		path = path[:len(path)-1]
+	}
+	visit("")
+
+	return cycles
 }
 
 func (graph *Graph) Search(importPath string) *Node {
@@ -48,6 +167,50 @@ func (graph *Graph) Search(importPath string) *Node {
 	return nil
 }
 
+// Lookup finds the node for exactly importPath, unlike Search
+// which stops at the first leaf along the path.
+func (graph *Graph) Lookup(importPath string) *Node {
+	if node := graph.node(importPath); node != nil && node.Leaf {
+		return node
+	}
+	return nil
+}
+
+// The node for importPath, whether it holds a dependency
+// or is only part of the path to one.
+func (graph *Graph) node(importPath string) *Node {
+	nodes := graph.Nodes
+	var node *Node
+
+	for _, key := range strings.Split(importPath, "/") {
+		node = nodes[key]
+		if node == nil {
+			return nil
+		}
+		nodes = node.Nodes
+	}
+	return node
+}
+
+// The dependencies stored in the graph leafs, in insertion order.
+func (graph *Graph) Dependencies() []*Dep {
+	deps := []*Dep{}
+	seen := make(map[string]bool)
+
+	for e := graph.Leafs.Front(); e != nil; e = e.Next() {
+		importPath := e.Value.(string)
+		if seen[importPath] {
+			continue
+		}
+		seen[importPath] = true
+
+		if node := graph.Lookup(importPath); node != nil && node.Dependency != nil {
+			deps = append(deps, node.Dependency)
+		}
+	}
+	return deps
+}
+
 func (graph *Graph) deepInsert(nodes map[string]*Node, keys []string, dependency *Dep) *Node {
 	node, found := nodes[keys[0]]
 	if found == false {
@@ -142,3 +142,78 @@ func TestInsertingLeafs(t *testing.T) {
 		t.Fatal("Expected to have github.com/d2fn/gopack in the list of leafs")
 	}
 }
+
+func TestInsertKeepsFirstDeclaration(t *testing.T) {
+	graph := NewGraph()
+	root := &Dep{Import: "github.com/d2fn/gopack", CheckoutFlag: TagFlag, CheckoutSpec: "v1.0.0"}
+	transitive := &Dep{Import: "github.com/d2fn/gopack", CheckoutFlag: BranchFlag, CheckoutSpec: "master"}
+
+	if !graph.Insert(root) {
+		t.Error("Expected the first declaration to be inserted")
+	}
+
+	if graph.Insert(transitive) {
+		t.Error("Expected the second declaration to be ignored")
+	}
+
+	if graph.Search("github.com/d2fn/gopack").Dependency != root {
+		t.Error("Expected the first declaration to win")
+	}
+
+	if len(graph.Conflicts) != 1 {
+		t.Fatalf("Expected 1 conflict, found %d", len(graph.Conflicts))
+	}
+
+	if graph.Conflicts[0].Kept != root || graph.Conflicts[0].Ignored != transitive {
+		t.Error("Expected the conflict to keep the first declaration")
+	}
+
+	if graph.Leafs.Len() != 1 {
+		t.Error("Expected the import to be a leaf only once")
+	}
+}
+
+func TestInsertSameVersionTwice(t *testing.T) {
+	graph := NewGraph()
+	graph.Insert(&Dep{Import: "github.com/d2fn/gopack", CheckoutFlag: TagFlag, CheckoutSpec: "v1.0.0"})
+	graph.Insert(&Dep{Import: "github.com/d2fn/gopack", CheckoutFlag: TagFlag, CheckoutSpec: "v1.0.0"})
+
+	if len(graph.Conflicts) != 0 {
+		t.Error("Expected no conflict when both declarations ask for the same version")
+	}
+}
+
+func TestCycles(t *testing.T) {
+	graph := NewGraph()
+	graph.Require("", &Dep{Import: "example.com/a"})
+	graph.Require("example.com/a", &Dep{Import: "example.com/b"})
+	graph.Require("example.com/b", &Dep{Import: "example.com/a"})
+	graph.Require("example.com/b", &Dep{Import: "example.com/app"})
+	graph.Require("example.com/b", &Dep{Import: "example.com/c"})
+
+	cycles := graph.Cycles("example.com/app")
+	expected := []string{
+		"example.com/a -> example.com/b -> example.com/a",
+		"example.com/app -> example.com/a -> example.com/b -> example.com/app",
+	}
+
+	if len(cycles) != len(expected) {
+		t.Fatalf("Expected %d cycles, found %v", len(expected), cycles)
+	}
+	for i, cycle := range cycles {
+		if strings.Join(cycle, " -> ") != expected[i] {
+			t.Errorf("Expected cycle %s but it was %v", expected[i], cycle)
+		}
+	}
+}
+
+func TestNoCycles(t *testing.T) {
+	graph := NewGraph()
+	graph.Require("", &Dep{Import: "example.com/a"})
+	graph.Require("", &Dep{Import: "example.com/b"})
+	graph.Require("example.com/a", &Dep{Import: "example.com/b"})
+
+	if cycles := graph.Cycles(""); len(cycles) != 0 {
+		t.Errorf("Expected no cycles, found %v", cycles)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const initHeader = `# Generated by "gp init" from the remote imports of the source tree.
+`
+
+// A dependency found by gp init.
+type initDep struct {
+	Name   string
+	Import string
+	// commit of the copy found on disk, if any
+	Commit string
+}
+
+// Write gopack.config with a dependency for every remote repository
+// imported by the project, refusing to overwrite an existing config
+// unless --force is given.
+func initProject(p *ProjectStats, gopath string, args []string) error {
+	flags := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := flags.Bool("force", false, "overwrite an existing gopack.config")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(pwd, "gopack.config")
+	if _, err := os.Stat(configPath); err == nil && !*force {
+		return &UsageError{fmt.Sprintf("%s already exists, use --force to overwrite it", configPath)}
+	}
+
+	deps := findInitDependencies(remoteImports(p), gopathDirs(gopath), make(map[string]bool))
+	for _, d := range deps {
+		if d.Commit == "" {
+			fmtcolor(Yellow, "no copy of %s was found, set its branch, commit, tag or version by hand\n", d.Import)
+		} else {
+			fmtcolor(Gray, "pinning %s at commit %s\n", d.Import, shortRevision(d.Commit))
+		}
+	}
+
+	if err := ioutil.WriteFile(configPath, initConfig(deps), 0644); err != nil {
+		return err
+	}
+	fmtcolor(Green, "wrote %s with %d dependencies\n", configPath, len(deps))
+	return nil
+}
+
+// The dirs to look for copies of dependencies in,
+// the vendor dir first and then the GOPATH of the user.
+func gopathDirs(gopath string) []string {
+	return append([]string{filepath.Join(pwd, VendorDir)}, filepath.SplitList(gopath)...)
+}
+
+func remoteImports(p *ProjectStats) []string {
+	imports := []string{}
+	for importPath, stats := range p.ImportStatsByPath {
+		if stats.Remote {
+			imports = append(imports, importPath)
+		}
+	}
+	return imports
+}
+
+// Collapse imports to their repository roots, looking for a copy
+// of each one in the given GOPATH dirs. Dependencies are named
+// so they don't clash with the names already taken.
+func findInitDependencies(imports []string, dirs []string, names map[string]bool) []*initDep {
+	self, _ := filepath.EvalSymlinks(pwd)
+
+	byRoot := make(map[string]*initDep)
+	for _, importPath := range imports {
+		root, src, scm := findRepository(importPath, dirs)
+		if _, found := byRoot[root]; found {
+			continue
+		}
+
+		d := &initDep{Import: root}
+		if src != "" {
+			// the project imports its own packages through GOPATH
+			if real, _ := filepath.EvalSymlinks(src); real == self {
+				continue
+			}
+			d.Commit, _ = scm.Revision(src)
+		}
+		byRoot[root] = d
+	}
+
+	roots := make([]string, 0, len(byRoot))
+	for root := range byRoot {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	deps := make([]*initDep, 0, len(roots))
+	for _, root := range roots {
+		d := byRoot[root]
+		d.Name = initDepName(root, names)
+		deps = append(deps, d)
+	}
+	return deps
+}
+
+// Find the repository an import belongs to. When a copy is found in dirs
+// its root is the closest directory holding scm metadata, otherwise
+// it's resolved like go get does.
+func findRepository(importPath string, dirs []string) (root, src string, scm Scm) {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		base := filepath.Join(dir, "src")
+
+		for p := importPath; strings.Contains(p, "/"); p = filepath.Dir(p) {
+			for key, s := range Scms {
+				if _, err := os.Stat(filepath.Join(base, p, HiddenDirs[key])); err == nil {
+					return p, filepath.Join(base, p), s
+				}
+			}
+		}
+	}
+
+	if repo, err := resolver.Resolve(importPath); err == nil {
+		return repo.Root, "", nil
+	}
+	return importPath, "", nil
+}
+
+// Name the dependency after the last segments of its import,
+// adding more of them until the name is unique.
+func initDepName(importPath string, names map[string]bool) string {
+	parts := strings.Split(importPath, "/")
+
+	name := ""
+	for i := len(parts) - 1; i >= 0; i-- {
+		name = lockKeyChars.ReplaceAllString(strings.Join(parts[i:], "_"), "_")
+		if !names[name] {
+			break
+		}
+	}
+	for n := 2; names[name]; n++ {
+		name = fmt.Sprintf("%s_%d", lockKeyChars.ReplaceAllString(importPath, "_"), n)
+	}
+
+	names[name] = true
+	return name
+}
+
+func initConfig(deps []*initDep) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(initHeader)
+
+	for _, d := range deps {
+		buf.WriteString("\n")
+		buf.WriteString(d.Table())
+	}
+
+	return buf.Bytes()
+}
+
+func (d *initDep) Table() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "[deps.%s]\n", d.Name)
+	fmt.Fprintf(&buf, "import = %s\n", strconv.Quote(d.Import))
+	if d.Commit != "" {
+		fmt.Fprintf(&buf, "commit = %s\n", strconv.Quote(d.Commit))
+	} else {
+		buf.WriteString("# no copy was found to pin, set a branch, commit, tag or version\n")
+	}
+	return buf.String()
+}
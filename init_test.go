@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func setupInitProject(t *testing.T) (string, string) {
+	setupTestPwd()
+
+	gopath, _ := ioutil.TempDir("", "gopack-gopath-")
+	repo := path.Join(gopath, "src", "github.com", "me", "lib")
+	createPath(path.Join(repo, "sub"))
+	git(t, repo, "init", "-q", "-b", "master")
+	revision := commitGitFile(t, repo, "sub/sub.go", "package sub\n")
+
+	err := ioutil.WriteFile(path.Join(pwd, "main.go"), []byte(`package main
+
+import (
+	"fmt"
+	"github.com/me/lib/sub"
+	"github.com/someone/missing/pkg"
+)
+`), 0644)
+	check(err)
+
+	return gopath, revision
+}
+
+func TestFindInitDependencies(t *testing.T) {
+	gopath, revision := setupInitProject(t)
+
+	p, err := AnalyzeSourceTree(pwd)
+	check(err)
+
+	deps := findInitDependencies(remoteImports(p), []string{gopath}, make(map[string]bool))
+	if len(deps) != 2 {
+		t.Fatalf("Expected 2 dependencies but found %d", len(deps))
+	}
+
+	lib, missing := deps[0], deps[1]
+	if lib.Import != "github.com/me/lib" || lib.Name != "lib" || lib.Commit != revision {
+		t.Errorf("Expected github.com/me/lib at %s but it was %s %s at %s", revision, lib.Name, lib.Import, lib.Commit)
+	}
+
+	if missing.Import != "github.com/someone/missing" || missing.Commit != "" {
+		t.Errorf("Expected github.com/someone/missing without commit but it was %s at %s", missing.Import, missing.Commit)
+	}
+}
+
+func TestInitProject(t *testing.T) {
+	gopath, revision := setupInitProject(t)
+	createFixtureConfig(pwd, "")
+
+	p, err := AnalyzeSourceTree(pwd)
+	check(err)
+	check(initProject(p, gopath, []string{"--force"}))
+
+	config := loadTestConfig(pwd)
+	if config.DepsTree == nil {
+		t.Fatal("Expected gp init to write the dependencies")
+	}
+
+	if commit := config.DepsTree.Get("lib.commit"); commit != revision {
+		t.Errorf("Expected lib to be pinned at %s but it was %v", revision, commit)
+	}
+
+	if missing := config.DepsTree.Get("missing.import"); missing != "github.com/someone/missing" {
+		t.Errorf("Expected missing to be github.com/someone/missing but it was %v", missing)
+	}
+}
+
+func TestInitDepName(t *testing.T) {
+	names := make(map[string]bool)
+
+	expected := map[string]string{
+		"github.com/a/mux":      "mux",
+		"github.com/b/mux":      "b_mux",
+		"gopkg.in/yaml.v2":      "yaml_v2",
+		"code.google.com/p/mux": "p_mux",
+	}
+
+	for _, i := range []string{"github.com/a/mux", "github.com/b/mux", "gopkg.in/yaml.v2", "code.google.com/p/mux"} {
+		if name := initDepName(i, names); name != expected[i] {
+			t.Errorf("Expected %s to be named %s but it was %s", i, expected[i], name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+const lockHeader = `# This file is generated by gopack, do not edit it by hand.
+# Run "gp update [import...]" to move dependencies to newer revisions.
+`
+
+var lockKeyChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Lock pins every resolved dependency to the revision that was checked out,
+// so builds of the same commit get the same code on every machine.
+type Lock struct {
+	// Path to the lock file.
+	Path    string
+	Entries map[string]*LockEntry
+}
+
+type LockEntry struct {
+	Import       string
+	Scm          string
+	Source       string
+	CheckoutType string
+	CheckoutSpec string
+	// concrete revision that was checked out
+	Revision string
+	// hash of the content of the checkout, see treeHash
+	Hash string
+}
+
+func NewLock(dir string) *Lock {
+	return &Lock{
+		Path:    filepath.Join(dir, GopackLock),
+		Entries: make(map[string]*LockEntry)}
+}
+
+// LoadLock reads the lock file in dir. A missing lock file
+// is not an error, it just yields an empty lock.
+func LoadLock(dir string) (*Lock, error) {
+	lock := NewLock(dir)
+
+	if _, err := os.Stat(lock.Path); os.IsNotExist(err) {
+		return lock, nil
+	}
+
+	t, err := toml.LoadFile(lock.Path)
+	if err != nil {
+		return nil, &ConfigError{lock.Path, err}
+	}
+
+	depsTree, _ := t.Get("deps").(*toml.TomlTree)
+	if depsTree == nil {
+		return lock, nil
+	}
+
+	for _, k := range depsTree.Keys() {
+		entryTree, ok := depsTree.Get(k).(*toml.TomlTree)
+		if !ok {
+			return nil, &ConfigError{lock.Path, fmt.Errorf("invalid lock entry %s", k)}
+		}
+
+		entry := &LockEntry{
+			Import:   lockString(entryTree, ImportProp),
+			Scm:      lockString(entryTree, "scm"),
+			Source:   lockString(entryTree, "source"),
+			Revision: lockString(entryTree, "revision"),
+			Hash:     lockString(entryTree, "hash")}
+
+		for _, prop := range []string{BranchProp, CommitProp, TagProp, VersionProp} {
+			if spec := lockString(entryTree, prop); spec != "" {
+				entry.CheckoutType = prop
+				entry.CheckoutSpec = spec
+			}
+		}
+
+		if entry.Import == "" || entry.Revision == "" {
+			return nil, &ConfigError{lock.Path, fmt.Errorf("lock entry %s needs an import and a revision", k)}
+		}
+
+		lock.Entries[entry.Import] = entry
+	}
+
+	return lock, nil
+}
+
+func lockString(t *toml.TomlTree, key string) string {
+	s, _ := t.Get(key).(string)
+	return s
+}
+
+// Pin points the dependency at its locked revision, as long as the lock
+// entry was resolved from the same scm, source and checkout spec.
+func (l *Lock) Pin(d *Dep) {
+	if l == nil {
+		return
+	}
+
+	entry, found := l.Entries[d.Import]
+	if found && entry.Matches(d) {
+		d.Revision = entry.Revision
+	}
+}
+
+// Release drops the entries for the given imports, or every entry if none
+// is given, so those dependencies get resolved again.
+func (l *Lock) Release(imports ...string) {
+	if len(imports) == 0 {
+		l.Entries = make(map[string]*LockEntry)
+	}
+
+	for _, i := range imports {
+		delete(l.Entries, i)
+	}
+}
+
+// Record replaces the lock entries with the revisions currently
+// checked out for the given dependencies.
+func (l *Lock) Record(deps []*Dep) {
+	entries := make(map[string]*LockEntry)
+
+	for _, d := range deps {
+		revision, err := d.CurrentRevision()
+		if err != nil {
+			fmtcolor(Gray, "couldn't find the revision of %s: %s\n", d.Import, err)
+			// keep whatever revision this dependency was pinned to
+			revision = d.Revision
+		}
+
+		if revision == "" {
+			continue
+		}
+
+		entries[d.Import] = &LockEntry{
+			Import:       d.Import,
+			Scm:          d.Scm,
+			Source:       d.Source,
+			CheckoutType: d.CheckoutType(),
+			CheckoutSpec: d.CheckoutSpec,
+			Revision:     revision,
+			Hash:         l.hash(d, revision)}
+	}
+
+	l.Entries = entries
+}
+
+// The content hash of the dep, taken when its revision is first
+// recorded so that later edits to the checkout don't go unnoticed.
+func (l *Lock) hash(d *Dep, revision string) string {
+	if old, found := l.Entries[d.Import]; found && old.Revision == revision && old.Hash != "" {
+		return old.Hash
+	}
+
+	hash, err := treeHash(d.Src())
+	if err != nil {
+		fmtcolor(Gray, "couldn't hash the content of %s: %s\n", d.Import, err)
+	}
+	return hash
+}
+
+func (l *Lock) Write() error {
+	imports := make([]string, 0, len(l.Entries))
+	for i := range l.Entries {
+		imports = append(imports, i)
+	}
+	sort.Strings(imports)
+
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+
+	keys := make(map[string]bool)
+	for _, i := range imports {
+		e := l.Entries[i]
+
+		key := lockKeyChars.ReplaceAllString(e.Import, "_")
+		for n := 2; keys[key]; n++ {
+			key = fmt.Sprintf("%s_%d", lockKeyChars.ReplaceAllString(e.Import, "_"), n)
+		}
+		keys[key] = true
+
+		fmt.Fprintf(&buf, "\n[deps.%s]\n", key)
+		writeLockProp(&buf, ImportProp, e.Import)
+		writeLockProp(&buf, "scm", e.Scm)
+		writeLockProp(&buf, "source", e.Source)
+		if e.CheckoutType != "" {
+			writeLockProp(&buf, e.CheckoutType, e.CheckoutSpec)
+		}
+		writeLockProp(&buf, "revision", e.Revision)
+		writeLockProp(&buf, "hash", e.Hash)
+	}
+
+	return ioutil.WriteFile(l.Path, buf.Bytes(), 0644)
+}
+
+func writeLockProp(buf *bytes.Buffer, key, value string) {
+	if value != "" {
+		fmt.Fprintf(buf, "  %s = %s\n", key, strconv.Quote(value))
+	}
+}
+
+func (e *LockEntry) Matches(d *Dep) bool {
+	return e.Scm == d.Scm &&
+		e.Source == d.Source &&
+		e.CheckoutType == d.CheckoutType() &&
+		e.CheckoutSpec == d.CheckoutSpec &&
+		// the revision of an archive is its checksum
+		(d.Sha256 == "" || e.Revision == d.Sha256)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestWriteAndLoadLock(t *testing.T) {
+	setupTestPwd()
+
+	lock := NewLock(pwd)
+	lock.Entries["github.com/d2fn/gopack"] = &LockEntry{
+		Import:       "github.com/d2fn/gopack",
+		Scm:          "git",
+		Source:       "https://github.com/d2fn/gopack.git",
+		CheckoutType: "branch",
+		CheckoutSpec: "master",
+		Revision:     "182cae2ee3926a960223d8db4998aa9d57c89788",
+		Hash:         "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+	lock.Entries["github.com/pelletier/go-toml"] = &LockEntry{
+		Import:   "github.com/pelletier/go-toml",
+		Scm:      "go",
+		Revision: "23d36c08ab90f4957ae8e7d781907c368f5454dd"}
+
+	if err := lock.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadLock(pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Entries) != 2 {
+		t.Fatalf("Expected 2 lock entries, found %d", len(loaded.Entries))
+	}
+
+	for i, e := range lock.Entries {
+		if *loaded.Entries[i] != *e {
+			t.Errorf("Expected lock entry %v but it was %v", e, loaded.Entries[i])
+		}
+	}
+}
+
+func TestLoadMissingLock(t *testing.T) {
+	setupTestPwd()
+
+	lock, err := LoadLock(pwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lock.Entries) != 0 {
+		t.Errorf("Expected an empty lock when there is no lock file")
+	}
+}
+
+func TestPinLockedDependencies(t *testing.T) {
+	config := setupTestConfig(`
+[deps.testgopack]
+  import = "github.com/calavera/testGoPack"
+  branch = "master"
+`)
+
+	config.Lock = NewLock(pwd)
+	config.Lock.Entries["github.com/calavera/testGoPack"] = &LockEntry{
+		Import:       "github.com/calavera/testGoPack",
+		Scm:          "go",
+		CheckoutType: "branch",
+		CheckoutSpec: "master",
+		Revision:     "182cae2ee3926a960223d8db4998aa9d57c89788"}
+
+	deps := loadUnchanged(config)
+	dep := deps.DepList[0]
+
+	if dep.Revision != "182cae2ee3926a960223d8db4998aa9d57c89788" {
+		t.Errorf("Expected dependency to be pinned to the locked revision")
+	}
+
+	if dep.fetch {
+		t.Errorf("Expected to not fetch locked dependencies")
+	}
+}
+
+func TestIgnoreLockWhenSpecChanges(t *testing.T) {
+	config := setupTestConfig(`
+[deps.testgopack]
+  import = "github.com/calavera/testGoPack"
+  branch = "develop"
+`)
+
+	config.Lock = NewLock(pwd)
+	config.Lock.Entries["github.com/calavera/testGoPack"] = &LockEntry{
+		Import:       "github.com/calavera/testGoPack",
+		Scm:          "go",
+		CheckoutType: "branch",
+		CheckoutSpec: "master",
+		Revision:     "182cae2ee3926a960223d8db4998aa9d57c89788"}
+
+	deps, _ := config.LoadDependencyModel(NewGraph())
+	if deps.DepList[0].Revision != "" {
+		t.Errorf("Expected to ignore the lock entry resolved for another branch")
+	}
+}
+
+func TestLockedRevisionIsHonoured(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	first := commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, repo))
+
+	config, deps := loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(deps))
+	check(config.WriteLock(deps))
+
+	lock, _ := LoadLock(pwd)
+	if lock.Entries["example.com/lib"].Revision != first {
+		t.Fatalf("Expected lock to record revision %s", first)
+	}
+
+	commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 2\n")
+
+	config, deps = loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(deps))
+
+	revision, err := deps.DepList[0].CurrentRevision()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revision != first {
+		t.Errorf("Expected dependency to stay at locked revision %s but it was %s", first, revision)
+	}
+}
+
+func TestMissingLockedRevisionFails(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	config, _ := setupGitProject(t, repo, `branch = "master"`)
+	check(ioutil.WriteFile(path.Join(pwd, "main.go"), []byte("package main\n\nimport _ \"example.com/lib\"\n"), 0644))
+
+	// the locked commit was force-pushed away upstream
+	config.Lock.Entries["example.com/lib"].Revision = "0123456789abcdef0123456789abcdef01234567"
+	check(config.Lock.Write())
+	locked, _ := ioutil.ReadFile(config.Lock.Path)
+
+	p, err := AnalyzeSourceTree(pwd)
+	check(err)
+	_, _, err = loadDependencies(pwd, p)
+	if code := ExitCode(err); code != ExitScm {
+		t.Fatalf("Expected exit code %d for a missing locked revision but it was %d - %v", ExitScm, code, err)
+	}
+
+	content, _ := ioutil.ReadFile(config.Lock.Path)
+	if string(content) != string(locked) {
+		t.Errorf("Expected the lock to be left as it was:\n%s", content)
+	}
+}
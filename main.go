@@ -1,18 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
+	"sync"
 )
 
 const (
 	GopackVersion      = "0.20.dev"
 	GopackDir          = ".gopack"
-	GopackChecksum     = ".gopack/checksum"
+	GopackFingerprints = ".gopack/fingerprints"
+	GopackLock         = "gopack.lock"
 	GopackTestProjects = ".gopack/test-projects"
 	VendorDir          = ".gopack/vendor"
+	DefaultJobs        = 4
+	TextFormat         = "text"
+	JSONFormat         = "json"
+	DotFormat          = "dot"
+	MermaidFormat      = "mermaid"
 )
 
 const (
@@ -20,12 +33,37 @@ const (
 	Green    = uint8(92)
 	Red      = uint8(31)
 	Gray     = uint8(90)
+	Yellow   = uint8(93)
 	EndColor = "\033[0m"
 )
 
 var (
 	pwd        string
 	showColors = true
+	// how many dependencies are fetched at once
+	jobs = DefaultJobs
+	// build from the vendored dependencies without reaching the network
+	offline = false
+	// the gopack command and its arguments, without gopack flags
+	commandArgs []string
+	// how gopack commands print their results, text or json
+	format = TextFormat
+	// where messages for humans go, stderr when printing json
+	output io.Writer = os.Stdout
+
+	// commands run by gopack itself rather than by the go tool,
+	// they accept gopack flags after the command name too
+	gopackCommands = map[string]bool{
+		"dependencytree": true,
+		"graph":          true,
+		"stats":          true,
+		"installdeps":    true,
+		"update":         true,
+		"vendor":         true,
+		"status":         true,
+		"outdated":       true,
+		"verify":         true,
+	}
 )
 
 func main() {
@@ -33,103 +71,449 @@ func main() {
 		showColors = false
 	}
 
+	if err := gopack(os.Args[1:]); err != nil {
+		report(err)
+		os.Exit(ExitCode(err))
+	}
+}
+
+// Run gp with its command line arguments. Nothing in here exits
+// the process, errors go back to main to pick the exit code.
+func gopack(args []string) error {
+	if err := parseFlags(args); err != nil {
+		return err
+	}
+
+	// gp init looks for dependencies in the GOPATH of the user too
+	gopath := os.Getenv("GOPATH")
+
 	// localize GOPATH
-	setupEnv()
+	if err := setupEnv(); err != nil {
+		return err
+	}
 
 	p, err := AnalyzeSourceTree(".")
 	if err != nil {
-		fail(err)
+		return err
 	}
 
-	config, deps := loadDependencies(".", p)
+	// these commands edit the config rather than load it
+	switch commandArgs[0] {
+	case "init":
+		return initProject(p, gopath, commandArgs[1:])
+	case "add":
+		return addCommand(commandArgs[1:])
+	case "remove":
+		return removeCommand(commandArgs[1:])
+	case "fix":
+		return fixProject(p, gopath)
+	case "verify":
+		return verifyCommand(commandArgs[1:])
+	case "status":
+		return statusCommand(commandArgs[1:])
+	case "outdated":
+		return outdatedCommand()
+	}
 
+	config, deps, err := loadDependencies(".", p)
+	if err != nil {
+		return err
+	}
 	if deps == nil {
-		fail("Error loading dependency info")
+		return NoDependenciesError(config)
 	}
 
-	switch os.Args[1] {
+	switch commandArgs[0] {
 	case "dependencytree":
+		if format == JSONFormat {
+			return deps.PrintDependencyTreeJSON()
+		}
 		deps.PrintDependencyTree()
+	case "graph":
+		switch format {
+		case JSONFormat:
+			return deps.PrintDependencyTreeJSON()
+		case MermaidFormat:
+			deps.WriteMermaid(os.Stdout)
+		default:
+			deps.WriteDot(os.Stdout)
+		}
 	case "stats":
+		if format == JSONFormat {
+			return p.PrintSummaryJSON()
+		}
 		p.PrintSummary()
 	case "installdeps":
-		deps.Install(config.Repository)
+		return deps.Install(config.Repository)
+	case "update":
+		return updateDependencies(config, deps, commandArgs[1:])
+	case "vendor":
+		return vendorCommand(deps, commandArgs[1:])
 	default:
-		runCommand()
+		return runCommand()
 	}
+	return nil
 }
 
-func loadDependencies(root string, p *ProjectStats) (*Config, *Dependencies) {
-	config, dependencies := loadConfiguration(root)
-	if dependencies != nil {
-		announceGopack()
-		failWith(dependencies.Validate(p))
-		// prepare dependencies
-		loadTransitiveDependencies(dependencies)
-		config.WriteChecksum()
+func loadDependencies(root string, p *ProjectStats) (*Config, *Dependencies, error) {
+	config, dependencies, err := loadConfiguration(root)
+	if err != nil || dependencies == nil {
+		return config, dependencies, err
+	}
+
+	announceGopack()
+	if err = validationError(dependencies.Validate(p)); err != nil {
+		return nil, nil, err
 	}
-	return config, dependencies
+	// prepare dependencies
+	if err = loadTransitiveDependencies(dependencies); err != nil {
+		return nil, nil, err
+	}
+	warnWith(dependencies.ConflictErrors())
+	warnWith(dependencies.CycleErrors())
+	if err = config.WriteLock(dependencies); err != nil {
+		return nil, nil, err
+	}
+	if err = config.WriteFingerprints(dependencies); err != nil {
+		return nil, nil, err
+	}
+	return config, dependencies, nil
 }
 
-func loadConfiguration(dir string) (*Config, *Dependencies) {
+func loadConfiguration(dir string) (*Config, *Dependencies, error) {
 	importGraph := NewGraph()
-	config := NewConfig(dir)
-	config.InitRepo(importGraph)
+	config, err := NewConfig(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = config.InitRepo(importGraph); err != nil {
+		return nil, nil, err
+	}
+
+	if config.Lock, err = LoadLock(dir); err != nil {
+		return nil, nil, err
+	}
+
+	if config.Fingerprints, err = LoadFingerprints(); err != nil {
+		return nil, nil, err
+	}
+
+	if err = config.setupMirrors(); err != nil {
+		return nil, nil, err
+	}
 
 	dependencies, err := config.LoadDependencyModel(importGraph)
 	if err != nil {
-		failf(err.Error())
+		return nil, nil, err
 	}
-	return config, dependencies
+	return config, dependencies, nil
 }
 
-func runCommand() {
-	first := os.Args[1]
+// Parse the gopack flags that come before the command,
+// and after it for the commands gopack runs itself.
+func parseFlags(args []string) error {
+	flags := flag.NewFlagSet("gp", flag.ContinueOnError)
+	flags.IntVar(&jobs, "j", DefaultJobs, "number of dependencies to fetch in parallel")
+	flags.StringVar(&format, "format", TextFormat, "output format of gopack commands, text or json, or dot or mermaid for graph")
+	flags.BoolVar(&offline, "offline", os.Getenv("GOPACK_OFFLINE") == "1", "use the vendored dependencies without fetching them")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gp [-j N] [-offline] [-format text|json|dot|mermaid] command [arguments]")
+		flags.PrintDefaults()
+	}
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	commandArgs = flags.Args()
+	if len(commandArgs) > 0 && gopackCommands[commandArgs[0]] {
+		gopackArgs, args := splitFlags(flags, commandArgs[1:])
+		if err := parseCommandFlags(flags, gopackArgs); err != nil {
+			return err
+		}
+		commandArgs = append([]string{commandArgs[0]}, args...)
+	}
+
+	if len(commandArgs) == 0 || jobs < 1 || !validFormat(commandArgs[0]) {
+		flags.Usage()
+		return &UsageError{}
+	}
+
+	// keep stdout for the output meant to be piped
+	if format == JSONFormat || commandArgs[0] == "graph" {
+		output = os.Stderr
+	}
+	return nil
+}
+
+// Parse the flags of a command. The flag package already
+// printed what's wrong with them when they don't parse.
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return &UsageError{}
+	}
+	return nil
+}
+
+// Separate the gopack flags from the arguments of the command,
+// which may have flags of its own like gp verify --hash.
+func splitFlags(flags *flag.FlagSet, args []string) (gopackArgs, rest []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.TrimLeft(args[i], "-")
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name = name[:eq]
+		}
+
+		f := flags.Lookup(name)
+		if !strings.HasPrefix(args[i], "-") || f == nil {
+			rest = append(rest, args[i])
+			continue
+		}
+
+		gopackArgs = append(gopackArgs, args[i])
+		// the value of -j 16 comes in the next argument
+		if b, ok := f.Value.(interface {
+			IsBoolFlag() bool
+		}); !strings.Contains(args[i], "=") && !(ok && b.IsBoolFlag()) && i+1 < len(args) {
+			i++
+			gopackArgs = append(gopackArgs, args[i])
+		}
+	}
+	return gopackArgs, rest
+}
+
+// dot and mermaid are only understood by gp graph.
+func validFormat(command string) bool {
+	switch format {
+	case TextFormat, JSONFormat:
+		return true
+	case DotFormat, MermaidFormat:
+		return command == "graph"
+	}
+	return false
+}
+
+func runCommand() error {
+	first := commandArgs[0]
 	if first == "version" {
 		fmt.Printf("gopack version %s\n", GopackVersion)
-		os.Exit(0)
+		return nil
 	}
 
-	run(os.Args[1:]...)
+	return run(commandArgs...)
 }
 
-func run(args ...string) {
+func run(args ...string) error {
 	cmd := exec.Command("go", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		fail(err)
-	}
+	return cmd.Run()
 }
 
-func loadTransitiveDependencies(dependencies *Dependencies) {
-	dependencies.VisitDeps(
-		func(dep *Dep) {
-			fmtcolor(Gray, "updating %s\n", dep.Import)
-			dep.Get()
+// Fetch the dependencies and then the ones declared by their own
+// configs, one level of the dependency tree at a time.
+func loadTransitiveDependencies(dependencies *Dependencies) error {
+	level := []*Dependencies{dependencies}
+	// the config of a dep is loaded once, even when a cycle leads back to it
+	loaded := make(map[string]bool)
+
+	for len(level) > 0 {
+		deps := []*Dep{}
+		for _, d := range level {
+			deps = append(deps, d.DepList...)
+		}
+		if err := validationError(fetchDependencies(deps)); err != nil {
+			return err
+		}
+
+		next, err := loadNextLevel(level, loaded)
+		if err != nil {
+			return err
+		}
+		level = next
+	}
+	return nil
+}
 
-			if dep.CheckoutType() != "" {
-				fmtcolor(Gray, "pointing %s at %s %s\n", dep.Import, dep.CheckoutType(), dep.CheckoutSpec)
-				dep.switchToBranchOrTag()
+// Load the configs of the deps of a level that weren't loaded yet.
+// They're loaded in the order of their paths, so when two configs
+// equally close to the project ask for different versions of an
+// import, the same one wins no matter who declared them.
+func loadNextLevel(level []*Dependencies, loaded map[string]bool) ([]*Dependencies, error) {
+	deps := []pendingConfig{}
+	for _, d := range level {
+		for _, dep := range d.DepList {
+			if !loaded[dep.Import] {
+				loaded[dep.Import] = true
+				deps = append(deps, pendingConfig{d, dep})
 			}
+		}
+	}
+	sort.Sort(bySrc(deps))
 
-			if dep.fetch {
-				transitive, err := dep.LoadTransitiveDeps(dependencies.ImportGraph)
-				if err != nil {
-					failf(err.Error())
-				}
-				if transitive != nil {
-					loadTransitiveDependencies(transitive)
+	next := []*Dependencies{}
+	for _, p := range deps {
+		transitive, err := p.dep.LoadTransitiveDeps(p.parent)
+		if err != nil {
+			return nil, err
+		}
+		if transitive != nil {
+			next = append(next, transitive)
+		}
+	}
+	return next, nil
+}
+
+// A dep whose config is still to be loaded, with the deps declaring it.
+type pendingConfig struct {
+	parent *Dependencies
+	dep    *Dep
+}
+
+type bySrc []pendingConfig
+
+func (s bySrc) Len() int           { return len(s) }
+func (s bySrc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s bySrc) Less(i, j int) bool { return s[i].dep.Src() < s[j].dep.Src() }
+
+// Fetch the deps with a pool of workers, printing
+// the output of every dep at once when it's done.
+// Deps sharing a working copy are fetched one after
+// the other by the same worker.
+func fetchDependencies(deps []*Dep) []*ProjectError {
+	groups := workingCopies(deps)
+	queue := make(chan []*Dep)
+	problems := make(chan *ProjectError, len(deps))
+
+	var printing sync.Mutex
+	var workers sync.WaitGroup
+
+	for i := 0; i < jobs && i < len(groups); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for group := range queue {
+				for _, dep := range group {
+					var buf bytes.Buffer
+					dep.out = &buf
+					if err := fetchDependency(dep); err != nil {
+						problems <- FetchError(dep, err)
+					}
+					dep.out = nil
+
+					printing.Lock()
+					io.Copy(output, &buf)
+					printing.Unlock()
 				}
 			}
-		})
+		}()
+	}
+
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	workers.Wait()
+	close(problems)
+
+	errors := []*ProjectError{}
+	for e := range problems {
+		errors = append(errors, e)
+	}
+	return errors
+}
+
+// Group the deps checked out in the same working copy, the ones
+// go get fetches from the same repository and the ones nested in
+// another dep. Deps in a group come after the ones they're nested in.
+func workingCopies(deps []*Dep) [][]*Dep {
+	sorted := make([]*Dep, len(deps))
+	copy(sorted, deps)
+	sort.Sort(byWorkingCopy(sorted))
+
+	roots := []string{}
+	groups := [][]*Dep{}
+	for _, dep := range sorted {
+		root := dep.workingCopy()
+		i := 0
+		for ; i < len(roots); i++ {
+			if root == roots[i] || strings.HasPrefix(root, roots[i]+"/") {
+				break
+			}
+		}
+		if i == len(roots) {
+			roots = append(roots, root)
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], dep)
+	}
+	return groups
+}
+
+// The import of the working copy the dep is checked out in.
+func (d *Dep) workingCopy() string {
+	if d.Scm == "go" {
+		if repo := staticRepoRoot(d.Import); repo != nil {
+			return repo.Root
+		}
+	}
+	return d.Import
+}
+
+// Sorts deps so the ones containing others come first.
+type byWorkingCopy []*Dep
+
+func (s byWorkingCopy) Len() int      { return len(s) }
+func (s byWorkingCopy) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byWorkingCopy) Less(i, j int) bool {
+	a, b := s[i].workingCopy(), s[j].workingCopy()
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return s[i].Import < s[j].Import
+}
+
+// Get the dep and point it at the right revision. When offline
+// the dep must already be vendored at its locked revision.
+func fetchDependency(dep *Dep) error {
+	// local deps are only linked, so they work offline too
+	if offline && dep.Scm != LocalTag {
+		if _, err := os.Stat(dep.Src()); err != nil && !dep.checkoutFromCache() {
+			return MissingDependencyError(dep, fmt.Sprintf("is not vendored in %s", dep.Src()))
+		}
+	} else {
+		dep.printf(Gray, "updating %s\n", dep.Import)
+		if err := dep.Get(); err != nil {
+			return err
+		}
+	}
+
+	if dep.Revision != "" {
+		dep.printf(Gray, "pointing %s at locked revision %s\n", dep.Import, dep.Revision)
+	} else if dep.CheckoutType() != "" {
+		dep.printf(Gray, "pointing %s at %s %s\n", dep.Import, dep.CheckoutType(), dep.CheckoutSpec)
+	} else {
+		return nil
+	}
+
+	// offline, the check below tells which revision is vendored instead
+	if err := dep.switchToBranchOrTag(); err != nil && !(offline && dep.Revision != "") {
+		return &ScmError{dep.Import, err}
+	}
+
+	if offline && dep.Revision != "" {
+		revision, _ := dep.CurrentRevision()
+		if revision != dep.Revision {
+			return MissingDependencyError(dep,
+				fmt.Sprintf("is vendored at revision %s instead of locked revision %s", shortRevision(revision), dep.Revision))
+		}
+	}
+	return nil
 }
 
 // Set the working directory.
 // It's the current directory by default.
 // It can be overriden setting the environment variable GOPACK_APP_CONFIG.
-func setPwd() {
+func setPwd() error {
 	var dir string
 	var err error
 
@@ -137,36 +521,40 @@ func setPwd() {
 	if dir == "" {
 		dir, err = os.Getwd()
 		if err != nil {
-			fail(err)
+			return err
 		}
 	}
 
 	pwd = dir
+	return nil
 }
 
 // set GOPATH to the local vendor dir
-func setupEnv() {
-	setPwd()
-	vendor := fmt.Sprintf("%s/%s", pwd, VendorDir)
-	err := os.Setenv("GOPATH", vendor)
-	if err != nil {
-		fail(err)
+func setupEnv() error {
+	if err := setPwd(); err != nil {
+		return err
 	}
+	vendor := fmt.Sprintf("%s/%s", pwd, VendorDir)
+	return os.Setenv("GOPATH", vendor)
 }
 
 func fmtcolor(c uint8, s string, args ...interface{}) {
+	fprintcolor(output, c, s, args...)
+}
+
+func fprintcolor(w io.Writer, c uint8, s string, args ...interface{}) {
 	if showColors {
-		fmt.Printf("\033[%dm", c)
+		fmt.Fprintf(w, "\033[%dm", c)
 	}
 
 	if len(args) > 0 {
-		fmt.Printf(s, args...)
+		fmt.Fprintf(w, s, args...)
 	} else {
-		fmt.Printf(s)
+		fmt.Fprint(w, s)
 	}
 
 	if showColors {
-		fmt.Printf(EndColor)
+		fmt.Fprint(w, EndColor)
 	}
 }
 
@@ -180,31 +568,43 @@ func logcolor(c uint8, s string, args ...interface{}) {
 	log.Printf(EndColor)
 }
 
-func failf(s string, args ...interface{}) {
-	fmtcolor(Red, s, args...)
-	os.Exit(1)
+// Tell the user why gp stopped, as JSON when that's the format.
+// Usage errors always go to stderr, next to the usage of the command.
+func report(err error) {
+	if e, ok := err.(*UsageError); ok {
+		if e.Message != "" {
+			fmt.Fprintln(os.Stderr, e.Message)
+		}
+		return
+	}
+
+	if format == JSONFormat {
+		printJSON(struct {
+			Errors []*ProjectError `json:"errors"`
+		}{asProjectErrors(err)})
+		return
+	}
+
+	fmtcolor(Red, "%s\n", err)
 }
 
-func fail(a ...interface{}) {
-	fmt.Printf("\033[%dm", Red)
-	fmt.Print(a)
-	fmt.Printf(EndColor)
-	os.Exit(1)
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(b)
+	fmt.Println()
+	return nil
 }
 
-func failWith(errors []*ProjectError) {
-	if len(errors) > 0 {
-		fmt.Printf("\033[%dm", Red)
-		for _, e := range errors {
-			fmt.Printf(e.String())
-		}
-		fmt.Printf(EndColor)
-		fmt.Println()
-		os.Exit(len(errors))
+func warnWith(errors []*ProjectError) {
+	for _, e := range errors {
+		fmtcolor(Yellow, "warning: %s", e.String())
 	}
 }
 
 func announceGopack() {
 	fmtcolor(104, "/// g o p a c k ///")
-	fmt.Println()
+	fmt.Fprintln(output)
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +26,159 @@ func TestSetPwdAppConfig(t *testing.T) {
 		t.Errorf("Expected pwd to be %s but it was %s.\n", dir, pwd)
 	}
 }
+
+func TestWorkingCopies(t *testing.T) {
+	deps := []*Dep{}
+	for _, i := range []string{"example.com/lib/sub", "github.com/x/y/pkg1", "example.com/other", "github.com/x/y/pkg2", "example.com/lib"} {
+		dep := NewDependency(i)
+		dep.Scm = GitTag
+		if strings.HasPrefix(i, "github.com/") {
+			dep.Scm = "go"
+		}
+		deps = append(deps, dep)
+	}
+
+	expected := [][]string{
+		{"github.com/x/y/pkg1", "github.com/x/y/pkg2"},
+		{"example.com/lib", "example.com/lib/sub"},
+		{"example.com/other"},
+	}
+
+	groups := workingCopies(deps)
+	if len(groups) != len(expected) {
+		t.Fatalf("Expected %d working copies but found %d", len(expected), len(groups))
+	}
+	for i, group := range groups {
+		imports := []string{}
+		for _, dep := range group {
+			imports = append(imports, dep.Import)
+		}
+		if strings.Join(imports, " ") != strings.Join(expected[i], " ") {
+			t.Errorf("Expected %v to be fetched together but it was %v", expected[i], imports)
+		}
+	}
+}
+
+// loadConfiguration for the configs a test expects to be valid.
+func loadTestConfiguration(dir string) (*Config, *Dependencies) {
+	config, deps, err := loadConfiguration(dir)
+	check(err)
+	return config, deps
+}
+
+func TestFetchDependenciesInParallel(t *testing.T) {
+	revisions := make(map[string]string)
+	fixture := ""
+	for _, name := range []string{"one", "two", "three"} {
+		repo := createGitRepo(t, name)
+		revisions["example.com/"+name] = commitGitFile(t, repo, name+".go", "package "+name+"\n")
+		fixture += fmt.Sprintf(`
+[deps.%s]
+  import = "example.com/%s"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, name, name, repo)
+	}
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fixture)
+
+	jobs = 2
+	defer func() { jobs = DefaultJobs }()
+
+	cwd, _ := os.Getwd()
+	config := loadTestConfig(pwd)
+	dependencies, _ := config.LoadDependencyModel(NewGraph())
+	check(loadTransitiveDependencies(dependencies))
+
+	for _, dep := range dependencies.DepList {
+		revision, _ := dep.CurrentRevision()
+		if revision != revisions[dep.Import] {
+			t.Errorf("Expected %s to be checked out at %s but it was %s", dep.Import, revisions[dep.Import], revision)
+		}
+	}
+
+	if dir, _ := os.Getwd(); dir != cwd {
+		t.Errorf("Expected fetching to leave the working directory at %s but it was %s", cwd, dir)
+	}
+}
+
+func TestOfflineMissingDependency(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	createGitProject(repo, `branch = "master"`)
+
+	offline = true
+	defer func() { offline = false }()
+
+	_, deps := loadTestConfiguration(pwd)
+	errors := fetchDependencies(deps.DepList)
+
+	if len(errors) != 1 || errors[0].Kind != MissingDep {
+		t.Fatalf("Expected a missing dependency error, found %v", errors)
+	}
+}
+
+func TestOfflineUsesVendoredDependencies(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	revision := commitGitFile(t, repo, "lib.go", "package lib\n")
+	setupGitProject(t, repo, `branch = "master"`)
+
+	// nothing can be fetched anymore
+	os.RemoveAll(repo)
+
+	offline = true
+	defer func() { offline = false }()
+
+	_, deps := loadTestConfiguration(pwd)
+	if errors := fetchDependencies(deps.DepList); len(errors) != 0 {
+		t.Fatalf("Expected no errors building offline, found %v", errors)
+	}
+
+	if current, _ := deps.DepList[0].CurrentRevision(); current != revision {
+		t.Errorf("Expected dependency to stay at %s but it was %s", revision, current)
+	}
+}
+
+func TestOfflineDependencyAtWrongRevision(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	config, deps := setupGitProject(t, repo, `branch = "master"`)
+
+	config.Lock.Entries["example.com/lib"] = &LockEntry{
+		Import:       "example.com/lib",
+		Scm:          "git",
+		Source:       deps.DepList[0].Source,
+		CheckoutType: "branch",
+		CheckoutSpec: "master",
+		Revision:     "0123456789abcdef0123456789abcdef01234567"}
+	config.Lock.Write()
+
+	offline = true
+	defer func() { offline = false }()
+
+	_, deps = loadTestConfiguration(pwd)
+	errors := fetchDependencies(deps.DepList)
+
+	if len(errors) != 1 || errors[0].Kind != MissingDep {
+		t.Fatalf("Expected a missing dependency error, found %v", errors)
+	}
+}
+
+func TestSplitFlags(t *testing.T) {
+	flags := flag.NewFlagSet("gp", flag.ContinueOnError)
+	flags.Int("j", DefaultJobs, "")
+	flags.String("format", TextFormat, "")
+	flags.Bool("offline", false, "")
+
+	gopackArgs, rest := splitFlags(flags, []string{"--hash", "-j", "8", "--offline", "prune", "--format=json", "--dry-run"})
+
+	if strings.Join(gopackArgs, " ") != "-j 8 --offline --format=json" {
+		t.Errorf("Expected the gopack flags to be picked, were %v", gopackArgs)
+	}
+	if strings.Join(rest, " ") != "--hash prune --dry-run" {
+		t.Errorf("Expected the command flags to be left alone, were %v", rest)
+	}
+}
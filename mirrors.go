@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches the scheme and user of urls like https://github.com/x
+// or ssh://git@github.com/x and the user of git@github.com:x.
+var sourceScheme = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.\-]*://)?([^@/]+@)?`)
+
+// A Mirror downloads the sources starting with Prefix from URL instead.
+type Mirror struct {
+	Prefix string
+	URL    string
+}
+
+// Mirrors are declared in tables like
+//
+//	[mirrors.github]
+//	prefix = "github.com/"
+//	url = "https://git.internal/github/"
+//
+// both in gopack.config and in the user's ~/.gopackrc, or $GOPACK_RC.
+type Mirrors []*Mirror
+
+func loadMirrors(t *toml.TomlTree, declared declarations, path string) (Mirrors, error) {
+	mirrors := Mirrors{}
+	if t == nil {
+		return mirrors, nil
+	}
+
+	tree, ok := t.Get("mirrors").(*toml.TomlTree)
+	if !ok {
+		return mirrors, nil
+	}
+
+	for _, k := range declared.keys(tree, "mirrors") {
+		m, ok := tree.Get(k).(*toml.TomlTree)
+		if !ok {
+			return nil, fmt.Errorf("%s - mirrors.%s must be a table with a prefix and url", path, k)
+		}
+
+		prefix, _ := m.Get("prefix").(string)
+		url, _ := m.Get("url").(string)
+		if prefix == "" || url == "" {
+			return nil, fmt.Errorf("%s - mirrors.%s needs both a prefix and url", path, k)
+		}
+		mirrors = append(mirrors, &Mirror{prefix, url})
+	}
+	return mirrors, nil
+}
+
+// The mirrors of the user, that apply to every project.
+func loadUserMirrors() (Mirrors, error) {
+	path := os.Getenv("GOPACK_RC")
+	if path == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return Mirrors{}, nil
+		}
+		path = filepath.Join(home, ".gopackrc")
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return Mirrors{}, nil
+	}
+
+	t, declared, err := loadTomlFile(path)
+	if err != nil {
+		return nil, &ConfigError{path, err}
+	}
+
+	mirrors, err := loadMirrors(t, declared, path)
+	if err != nil {
+		return nil, &ConfigError{path, err}
+	}
+	return mirrors, nil
+}
+
+// Rewrite the source with the mirror of the longest matching prefix,
+// the first declared one winning ties. Sources and prefixes are compared
+// without scheme or user, so "github.com/" matches both
+// https://github.com/gorilla/mux and git@github.com:gorilla/mux.git.
+func (mirrors Mirrors) Rewrite(source string) string {
+	normalized := normalizeSource(source)
+
+	var match *Mirror
+	for _, m := range mirrors {
+		prefix := normalizeSource(m.Prefix)
+		if strings.HasPrefix(normalized, prefix) && (match == nil || len(prefix) > len(normalizeSource(match.Prefix))) {
+			match = m
+		}
+	}
+
+	if match == nil {
+		return source
+	}
+	return match.URL + normalized[len(normalizeSource(match.Prefix)):]
+}
+
+func normalizeSource(source string) string {
+	loc := sourceScheme.FindStringSubmatchIndex(source)
+	s := source[loc[1]:]
+
+	// scp like git@github.com:gorilla/mux.git
+	if loc[2] < 0 && loc[4] >= 0 {
+		s = strings.Replace(s, ":", "/", 1)
+	}
+	return s
+}
+
+// Make git fetch through the mirrors too, for the deps
+// downloaded by go get, using the insteadOf url rewrites
+// git reads from the environment.
+// The entries the user already exported are kept, ours go after them.
+func (mirrors Mirrors) setupGit() {
+	count, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	for _, m := range mirrors {
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", count), fmt.Sprintf("url.%s.insteadOf", m.URL))
+		os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", count), "https://"+normalizeSource(m.Prefix))
+		count++
+	}
+	if len(mirrors) > 0 {
+		os.Setenv("GIT_CONFIG_COUNT", fmt.Sprint(count))
+	}
+}
+
+// Add the mirrors of the user to the config's, for the same
+// prefix the mirrors of the user win, and make git use them.
+func (c *Config) setupMirrors() error {
+	mirrors, err := loadUserMirrors()
+	if err != nil {
+		return err
+	}
+	c.Mirrors = append(mirrors, c.Mirrors...)
+	c.Mirrors.setupGit()
+	return nil
+}
+
+// Where the dep is downloaded from, its mirror if it has one.
+func (d *Dep) DownloadSource() string {
+	if d.Mirror != "" {
+		return d.Mirror
+	}
+	return d.Source
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestRewriteSource(t *testing.T) {
+	mirrors := Mirrors{
+		{"github.com/", "https://git.internal/github/"},
+		{"github.com/me/", "https://git.internal/mine/"},
+		{"https://example.com/releases/", "https://files.internal/releases/"},
+	}
+
+	expected := map[string]string{
+		"https://github.com/gorilla/mux":         "https://git.internal/github/gorilla/mux",
+		"git@github.com:gorilla/mux.git":         "https://git.internal/github/gorilla/mux.git",
+		"ssh://git@github.com/gorilla/mux":       "https://git.internal/github/gorilla/mux",
+		"https://github.com/me/lib":              "https://git.internal/mine/lib",
+		"http://example.com/releases/lib.tar.gz": "https://files.internal/releases/lib.tar.gz",
+		"https://bitbucket.org/user/repo":        "https://bitbucket.org/user/repo",
+		"/home/me/src/github.com/gorilla/mux":    "/home/me/src/github.com/gorilla/mux",
+	}
+
+	for source, mirror := range expected {
+		if rewritten := mirrors.Rewrite(source); rewritten != mirror {
+			t.Errorf("Expected %s to be downloaded from %s but it was %s", source, mirror, rewritten)
+		}
+	}
+}
+
+func TestInvalidMirrors(t *testing.T) {
+	setupTestPwd()
+
+	for _, fixture := range []string{`
+[mirrors]
+  github = "https://git.internal/github/"`, `
+[mirrors.github]
+  url = "https://git.internal/github/"`} {
+		createFixtureConfig(pwd, fixture)
+		f := path.Join(pwd, "gopack.config")
+		tree, _ := toml.LoadFile(f)
+		if _, err := loadMirrors(tree, nil, f); err == nil {
+			t.Errorf("Expected mirrors to be invalid - %s", fixture)
+		}
+	}
+}
+
+// Serve the repository from a mirror dir as mirror/me/lib.
+func createMirror(t *testing.T) (string, string) {
+	repo := createGitRepo(t, "lib")
+	revision := commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	mirror, _ := ioutil.TempDir("", "gopack-mirror-")
+	createPath(path.Join(mirror, "me"))
+	git(t, mirror, "clone", "-q", "--bare", repo, "me/lib")
+	return mirror, revision
+}
+
+func resetGitConfig() {
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, "GIT_CONFIG_") {
+			os.Setenv(strings.SplitN(v, "=", 2)[0], "")
+		}
+	}
+}
+
+func TestDownloadFromMirror(t *testing.T) {
+	mirror, revision := createMirror(t)
+	defer resetGitConfig()
+
+	for _, user := range []bool{false, true} {
+		setupTestPwd()
+		setupEnv()
+
+		mirrors := fmt.Sprintf(`
+[mirrors.internal]
+  prefix = "github.invalid/"
+  url = "%s/"
+`, mirror)
+		fixture := `
+[deps.lib]
+  import = "github.invalid/me/lib"
+  branch = "master"
+  scm = "git"
+  source = "https://github.invalid/me/lib"
+`
+		rc := path.Join(pwd, "gopackrc")
+		if user {
+			ioutil.WriteFile(rc, []byte(mirrors), 0644)
+		} else {
+			fixture = mirrors + fixture
+		}
+		os.Setenv("GOPACK_RC", rc)
+		createFixtureConfig(pwd, fixture)
+
+		config, deps := loadTestConfiguration(pwd)
+		check(loadTransitiveDependencies(deps))
+		check(config.WriteLock(deps))
+
+		if current, _ := deps.DepList[0].CurrentRevision(); current != revision {
+			t.Errorf("Expected the dependency to be downloaded from the mirror at %s but it was at %s", revision, current)
+		}
+
+		lock, _ := LoadLock(pwd)
+		if e := lock.Entries["github.invalid/me/lib"]; e == nil || e.Source != "https://github.invalid/me/lib" {
+			t.Errorf("Expected the lock to keep the source of the config, %v", e)
+		}
+	}
+	os.Setenv("GOPACK_RC", "")
+}
+
+func TestGitThroughMirror(t *testing.T) {
+	mirror, revision := createMirror(t)
+	defer resetGitConfig()
+
+	Mirrors{{"github.invalid/", mirror + "/"}}.setupGit()
+
+	out, err := exec.Command("git", "ls-remote", "https://github.invalid/me/lib", "HEAD").Output()
+	if err != nil || !strings.HasPrefix(string(out), revision) {
+		t.Errorf("Expected git to reach github.invalid through the mirror, %s %s", out, err)
+	}
+}
+
+func TestGitKeepsUserConfig(t *testing.T) {
+	defer resetGitConfig()
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+	os.Setenv("GIT_CONFIG_KEY_0", "user.name")
+	os.Setenv("GIT_CONFIG_VALUE_0", "someone")
+
+	Mirrors{{"github.invalid/", "https://mirror.invalid/"}}.setupGit()
+
+	if os.Getenv("GIT_CONFIG_KEY_0") != "user.name" || os.Getenv("GIT_CONFIG_VALUE_0") != "someone" {
+		t.Errorf("Expected the git config of the user to be kept")
+	}
+	if os.Getenv("GIT_CONFIG_COUNT") != "2" || os.Getenv("GIT_CONFIG_KEY_1") != "url.https://mirror.invalid/.insteadOf" {
+		t.Errorf("Expected the mirror to be configured after the config of the user")
+	}
+}
+
+func TestAddThroughUserMirror(t *testing.T) {
+	mirror, revision := createMirror(t)
+	defer resetGitConfig()
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, "")
+
+	rc := path.Join(pwd, "gopackrc")
+	ioutil.WriteFile(rc, []byte(fmt.Sprintf(`
+[mirrors.internal]
+  prefix = "github.invalid/"
+  url = "%s/"
+`, mirror)), 0644)
+	os.Setenv("GOPACK_RC", rc)
+	defer os.Setenv("GOPACK_RC", "")
+
+	check(addCommand([]string{"github.invalid/me/lib", "--scm", "git", "--source", "https://github.invalid/me/lib", "--branch", "master"}))
+
+	if current, _ := NewDependency("github.invalid/me/lib").CurrentRevision(); current != revision {
+		t.Errorf("Expected gp add to fetch through the mirror of the user at %s but it was at %s", revision, current)
+	}
+}
@@ -1,22 +1,27 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/pelletier/go-toml"
-	"log"
+	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
 const (
-	ImportProp = "import"
-	BranchProp = "branch"
-	CommitProp = "commit"
-	TagProp    = "tag"
-	BranchFlag = 1 << 0
-	CommitFlag = 1 << 1
-	TagFlag    = 1 << 2
+	ImportProp  = "import"
+	BranchProp  = "branch"
+	CommitProp  = "commit"
+	TagProp     = "tag"
+	VersionProp = "version"
+	BranchFlag  = 1 << 0
+	CommitFlag  = 1 << 1
+	TagFlag     = 1 << 2
+	VersionFlag = 1 << 3
 )
 
 var (
@@ -38,13 +43,16 @@ type Dependencies struct {
 	Keys        []string
 	DepList     []*Dep
 	ImportGraph *Graph
+	// configuration these dependencies were loaded from
+	Config *Config
 }
 
 type Dep struct {
 	Import string
-	// which of BranchFlag, CommitFlag, TagFlag is this repo
+	// which of BranchFlag, CommitFlag, TagFlag, VersionFlag is this repo
 	CheckoutFlag uint8
-	// the name of the thing to checkout whether it be a commit, branch, or tag
+	// the name of the thing to checkout whether it be a commit, branch, tag
+	// or the semantic version constraint that picks the tag
 	CheckoutSpec string
 
 	// does this dep need to be fetched
@@ -54,6 +62,21 @@ type Dep struct {
 	Scm string
 	// whence the Scm should clone/checkout
 	Source string
+	// where Source is downloaded from instead, when a mirror matches it
+	Mirror string
+	// checksum of the archive downloaded from Source
+	Sha256 string
+
+	// the revision pinned in gopack.lock, if any
+	Revision string
+
+	// path to the config that declared this dep
+	Origin string
+	// what the config declared, when the root config replaced it
+	Replaces *Dep
+
+	// where progress is reported, stdout when nil
+	out io.Writer
 }
 
 func NewDependency(repo string) *Dep {
@@ -66,21 +89,30 @@ func (d *Dependencies) IncludesDependency(importPath string) (*Node, bool) {
 }
 
 func (d *Dep) Fetch(all bool) bool {
-	d.fetch = all || (d.CheckoutFlag != CommitFlag && d.CheckoutFlag != TagFlag)
+	d.fetch = all || (d.Revision == "" && d.CheckoutFlag != CommitFlag && d.CheckoutFlag != TagFlag)
 	return d.fetch
 }
 
-func (d *Dep) Get() {
+func (d *Dep) Get() error {
 	if d.fetch {
 		scm, err := NewScm(d)
 		if err != nil {
-			fail(err)
+			return &ScmError{d.Import, err}
 		}
-		err = scm.Init(d)
-		if err != nil {
-			fail(err)
+		if err = scm.Init(d); err != nil {
+			return &ScmError{d.Import, err}
 		}
 	}
+	return nil
+}
+
+// Report progress about this dep.
+func (d *Dep) printf(c uint8, s string, args ...interface{}) {
+	out := d.out
+	if out == nil {
+		out = output
+	}
+	fprintcolor(out, c, s, args...)
 }
 
 func (d *Dep) setCheckout(t *toml.TomlTree, key string, flag uint8) {
@@ -102,6 +134,11 @@ func (d *Dep) setScm(t *toml.TomlTree) {
 
 func (d *Dep) setSource(t *toml.TomlTree) {
 	source := t.Get("source")
+	if source == nil {
+		// local dependencies may name their directory with path
+		source = t.Get("path")
+	}
+
 	if source != nil {
 		d.Source = source.(string)
 	} else {
@@ -109,10 +146,32 @@ func (d *Dep) setSource(t *toml.TomlTree) {
 	}
 }
 
+func (d *Dep) setSha256(t *toml.TomlTree) {
+	if sum := t.Get("sha256"); sum != nil {
+		d.Sha256 = strings.ToLower(sum.(string))
+	}
+}
+
+// The directory a local dep links to. Relative paths
+// are relative to the config declaring the dep.
+func (d *Dep) LocalPath() string {
+	dir := strings.TrimPrefix(d.Source, "file://")
+	if !filepath.IsAbs(dir) && d.Origin != "" {
+		dir = filepath.Join(filepath.Dir(d.Origin), dir)
+	}
+	return dir
+}
+
 func (d *Dep) Validate() (err error) {
 	f := d.CheckoutFlag
 	if f&(f-1) != 0 {
-		err = fmt.Errorf("%s - only one of branch/commit/tag may be specified\n", d.Import)
+		err = fmt.Errorf("%s - only one of branch/commit/tag/version may be specified\n", d.Import)
+	}
+
+	if f == VersionFlag {
+		if _, e := ParseConstraint(d.CheckoutSpec); e != nil {
+			err = fmt.Errorf("%s - %s", d.Import, e)
+		}
 	}
 
 	if d.Scm != "go" && d.Source == "" {
@@ -122,6 +181,30 @@ func (d *Dep) Validate() (err error) {
 	if d.Scm == "go" && d.Source != "" {
 		err = fmt.Errorf("%s - Source set, but no scm", d.Import)
 	}
+
+	if d.Scm == ArchiveTag && d.Source != "" {
+		if f != 0 {
+			err = fmt.Errorf("%s - archive dependencies can't set a branch/commit/tag/version", d.Import)
+		}
+
+		if _, e := hex.DecodeString(d.Sha256); e != nil || len(d.Sha256) != 64 {
+			err = fmt.Errorf("%s - archive dependencies need the sha256 checksum of the archive", d.Import)
+		}
+	}
+
+	if d.Sha256 != "" && d.Scm != ArchiveTag {
+		err = fmt.Errorf("%s - sha256 is only used by archive dependencies", d.Import)
+	}
+
+	if d.Scm == LocalTag && d.Source != "" {
+		if f != 0 {
+			err = fmt.Errorf("%s - local dependencies can't set a branch/commit/tag/version", d.Import)
+		}
+
+		if stat, e := os.Stat(d.LocalPath()); e != nil || !stat.IsDir() {
+			err = fmt.Errorf("%s - local source %s is not a directory", d.Import, d.LocalPath())
+		}
+	}
 	return err
 }
 
@@ -149,38 +232,114 @@ func (d *Dependencies) AllDepsNeedFetching() bool {
 	return true
 }
 
+// All the dependencies resolved in the import graph, transitive
+// ones included, except for the project repository itself.
+func (d *Dependencies) Resolved() []*Dep {
+	repo := ""
+	if d.Config != nil {
+		repo = d.Config.Repository
+	}
+
+	deps := []*Dep{}
+	for _, dep := range d.ImportGraph.Dependencies() {
+		if dep.Import != repo {
+			deps = append(deps, dep)
+		}
+	}
+	return deps
+}
+
 func (d *Dependencies) String() string {
 	return fmt.Sprintf("imports = %s, keys = %s", d.Imports, d.Keys)
 }
 
+// Print what requires what, starting from the root config. Every
+// edge shows the version its config asks for and where it's declared.
+// The requirements of a dependency are only listed the first time
+// it shows up, later ones are marked with (*).
 func (d *Dependencies) PrintDependencyTree() {
-	d.ImportGraph.PreOrderVisit(
-		func(n *Node, depth int) {
-			fmt.Printf("depth = %d\n", depth)
-			indent := strings.Repeat(" ", depth*2)
-			dep := n.Dependency
-			bullet := "+-"
-			if n.Leaf {
-				bullet = "-"
-			}
-			if dep == nil {
-				fmt.Printf("%s%s %s\n", indent, bullet, n.Key)
-			} else {
-				fmt.Printf("%s%s %s @ %s\n", indent, bullet, dep.Import, dep.CheckoutSpec)
-			}
-		})
+	d.printRequirements(os.Stdout, "", 0, make(map[string]bool))
 }
 
-func (d *Dependencies) Install(repo string) {
+func (d *Dependencies) printRequirements(w io.Writer, parent string, depth int, listed map[string]bool) {
+	indent := strings.Repeat("  ", depth)
+
+	for _, edge := range d.ImportGraph.Requirements(parent) {
+		dep := edge.Dep
+		line := fmt.Sprintf("%s- %s @ %s", indent, dep.Import, dep.Spec())
+
+		if dep.Replaces != nil {
+			line += fmt.Sprintf(" (replaces %s)", dep.Replaces.Version())
+		}
+		if kept := d.keptInstead(dep); kept != nil {
+			line += fmt.Sprintf(" (ignored, using %s)", kept.Version())
+		}
+
+		requirements := d.ImportGraph.Requirements(dep.Import)
+		if listed[dep.Import] && len(requirements) > 0 {
+			line += " (*)"
+		}
+
+		fmt.Fprintf(w, "%s [%s]\n", line, relativePath(dep.Origin))
+
+		if !listed[dep.Import] {
+			listed[dep.Import] = true
+			d.printRequirements(w, dep.Import, depth+1, listed)
+		}
+	}
+}
+
+// The dep resolved for the import when the version dep
+// asks for lost a conflict, nil otherwise.
+func (d *Dependencies) keptInstead(dep *Dep) *Dep {
+	node := d.ImportGraph.Lookup(dep.Import)
+	if node == nil || node.Dependency == dep || dep.Import == d.ImportGraph.Root || node.Dependency.SameVersion(dep) {
+		return nil
+	}
+	return node.Dependency
+}
+
+// Path relative to the project when it's inside it.
+func relativePath(path string) string {
+	if rel, err := filepath.Rel(pwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func (d *Dependencies) PrintDependencyTreeJSON() error {
+	return printJSON(struct {
+		Dependencies []*Dep  `json:"dependencies"`
+		Requirements []*Edge `json:"requirements"`
+	}{d.Resolved(), d.ImportGraph.RequirementList()})
+}
+
+func (d *Dependencies) Install(repo string) error {
 	var importName string
 
 	for e := d.ImportGraph.Leafs.Front(); e != nil; e = e.Next() {
 		importName = e.Value.(string)
 
 		if importName != repo {
-			run("install", importName)
+			if err := run("install", importName); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
+
+func (d *Dep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Import       string `json:"import"`
+		Scm          string `json:"scm"`
+		Source       string `json:"source,omitempty"`
+		CheckoutType string `json:"checkout_type,omitempty"`
+		CheckoutSpec string `json:"checkout_spec,omitempty"`
+		Revision     string `json:"revision,omitempty"`
+		Origin       string `json:"origin,omitempty"`
+		Replaces     *Dep   `json:"replaces,omitempty"`
+	}{d.Import, d.Scm, d.Source, d.CheckoutType(), d.CheckoutSpec, d.Revision, d.Origin, d.Replaces})
 }
 
 func (d *Dep) String() string {
@@ -191,6 +350,31 @@ func (d *Dep) String() string {
 	}
 }
 
+// Whether both deps ask for the same code.
+func (d *Dep) SameVersion(other *Dep) bool {
+	return d.Scm == other.Scm &&
+		d.Source == other.Source &&
+		d.CheckoutFlag == other.CheckoutFlag &&
+		d.CheckoutSpec == other.CheckoutSpec
+}
+
+// Describe which version of the code the dep asks for.
+func (d *Dep) Version() string {
+	version := d.Spec()
+	if d.Source != "" {
+		version = fmt.Sprintf("%s from %s", version, d.Source)
+	}
+	return version
+}
+
+// The branch, commit, tag or version the dep checks out.
+func (d *Dep) Spec() string {
+	if d.CheckoutType() != "" {
+		return fmt.Sprintf("%s %s", d.CheckoutType(), d.CheckoutSpec)
+	}
+	return "default branch"
+}
+
 func (d *Dep) CheckoutType() string {
 	switch d.CheckoutFlag {
 	case BranchFlag:
@@ -199,6 +383,8 @@ func (d *Dep) CheckoutType() string {
 		return "tag"
 	case CommitFlag:
 		return "commit"
+	case VersionFlag:
+		return "version"
 	}
 	return ""
 }
@@ -209,57 +395,97 @@ func (d *Dep) Src() string {
 
 // switch the dep to the appropriate branch or tag
 func (d *Dep) switchToBranchOrTag() error {
-	err := d.cdSrc()
+	scm, err := NewScm(d)
 	if err != nil {
 		return err
 	}
 
-	scm, err := NewScm(d)
+	target, err := d.checkoutTarget(scm)
+	if err != nil {
+		return err
+	}
 
+	err = scm.Checkout(target)
 	if err != nil {
-		log.Println(err)
-	} else {
-		err = scm.Checkout(d)
+		return fmt.Errorf("error checking out %s on %s: %s", target.CheckoutSpec, d.Import, err)
+	}
+	return nil
+}
 
+// The dep to hand to the scm on checkout. Deps pinned
+// by the lock are checked out at their locked revision,
+// version constraints are resolved to the highest matching tag.
+func (d *Dep) checkoutTarget(scm Scm) (*Dep, error) {
+	target := *d
+
+	if d.Revision != "" {
+		target.CheckoutFlag = CommitFlag
+		target.CheckoutSpec = d.Revision
+	} else if d.CheckoutFlag == VersionFlag {
+		tag, err := d.ResolveVersion(scm)
 		if err != nil {
-			log.Printf("error checking out %s on %s\n", d.CheckoutSpec, d.Import)
+			return nil, err
 		}
+
+		d.printf(Gray, "resolved %s version %s to tag %s\n", d.Import, d.CheckoutSpec, tag)
+		target.CheckoutFlag = TagFlag
+		target.CheckoutSpec = tag
 	}
 
-	return cdHome()
+	return &target, nil
 }
 
-// Tell the scm where the dependency is hosted.
-func (d *Dep) scmPath(scmPath string) bool {
-	stat, err := os.Stat(scmPath)
+// Find the highest tag in the dep's repository
+// matching its version constraint.
+func (d *Dep) ResolveVersion(scm Scm) (string, error) {
+	constraint, err := ParseConstraint(d.CheckoutSpec)
 	if err != nil {
-		return false
+		return "", err
 	}
 
-	return stat.IsDir()
+	tags, err := scm.Tags(d.Src())
+	if err != nil {
+		return "", fmt.Errorf("couldn't list the tags of %s: %s", d.Import, err)
+	}
+
+	tag, found := constraint.LatestMatching(tags)
+	if !found {
+		return "", fmt.Errorf("no tag of %s matches version %s", d.Import, d.CheckoutSpec)
+	}
+	return tag, nil
 }
 
-func (d *Dep) cdSrc() error {
-	err := os.Chdir(d.Src())
+// Ask the scm which revision is checked out in the dep's source dir.
+func (d *Dep) CurrentRevision() (string, error) {
+	scm, err := NewScm(d)
 	if err != nil {
-		log.Print(err)
-		log.Printf("couldn't cd to src dir for %s\n", d.Import)
-		return err
+		return "", err
 	}
-	return nil
+	return scm.Revision(d.Src())
 }
 
-func cdHome() error {
-	return os.Chdir(pwd)
+// Tell the scm where the dependency is hosted.
+func (d *Dep) scmPath(scmPath string) bool {
+	stat, err := os.Stat(scmPath)
+	if err != nil {
+		return false
+	}
+
+	return stat.IsDir()
 }
 
-func (d *Dep) LoadTransitiveDeps(importGraph *Graph) (*Dependencies, error) {
+func (d *Dep) LoadTransitiveDeps(parent *Dependencies) (*Dependencies, error) {
 	configPath := path.Join(d.Src(), "gopack.config")
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil, nil
 	}
-	config := NewConfig(d.Src())
-	return config.LoadDependencyModel(importGraph)
+	config, err := NewConfig(d.Src())
+	if err != nil {
+		return nil, err
+	}
+	config.inherit(parent.Config)
+	config.Parent = d
+	return config.LoadDependencyModel(parent.ImportGraph)
 }
 
 func (d *Dependencies) Validate(p *ProjectStats) []*ProjectError {
@@ -271,6 +497,8 @@ func (d *Dependencies) Validate(p *ProjectStats) []*ProjectError {
 		if s.Remote {
 			if found {
 				includedDeps[node.Dependency.Import] = node.Dependency
+			} else if dep := d.sameRepository(path); dep != nil {
+				includedDeps[dep.Import] = dep
 			} else {
 				// report a validation error with the locations in source
 				// where an import is used but unmanaged in gopack.config
@@ -288,8 +516,52 @@ func (d *Dependencies) Validate(p *ProjectStats) []*ProjectError {
 	return errors
 }
 
-func ShowValidationErrors(errors []*ProjectError) {
-	for _, e := range errors {
-		fmt.Errorf("%s\n", e.String())
+// The dependency checked out from the same repository as the import,
+// which makes the import available even if it's not under the dependency.
+func (d *Dependencies) sameRepository(importPath string) *Dep {
+	// a repository doesn't span hosts, so there's nothing
+	// to look up unless a dependency shares the host
+	host := strings.SplitN(importPath, "/", 2)[0]
+	candidates := []*Dep{}
+	for _, dep := range d.ImportGraph.Dependencies() {
+		if strings.HasPrefix(dep.Import, host+"/") {
+			candidates = append(candidates, dep)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	repo := staticRepoRoot(importPath)
+	if repo == nil && !offline {
+		repo, _ = resolver.Resolve(importPath)
 	}
+	if repo == nil {
+		return nil
+	}
+
+	for _, dep := range candidates {
+		if dep.Import == repo.Root || strings.HasPrefix(dep.Import, repo.Root+"/") {
+			return dep
+		}
+	}
+	return nil
+}
+
+// Report the versions ignored because another
+// config asked for the same import first.
+func (d *Dependencies) ConflictErrors() []*ProjectError {
+	errors := []*ProjectError{}
+	for _, c := range d.ImportGraph.Conflicts {
+		errors = append(errors, VersionConflictError(c))
+	}
+	return errors
+}
+
+func (d *Dependencies) CycleErrors() []*ProjectError {
+	errors := []*ProjectError{}
+	for _, cycle := range d.ImportGraph.Cycles(d.Config.Repository) {
+		errors = append(errors, DependencyCycleError(cycle))
+	}
+	return errors
 }
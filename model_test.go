@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -17,6 +22,9 @@ func setupTestPwd() {
 	dir, _ := ioutil.TempDir("", "gopack-config-")
 	os.Setenv("GOPACK_APP_CONFIG", dir)
 	setPwd()
+
+	cache, _ := ioutil.TempDir("", "gopack-cache-")
+	os.Setenv("GOPACK_CACHE", cache)
 }
 
 func createPath(path string) {
@@ -24,6 +32,62 @@ func createPath(path string) {
 	check(err)
 }
 
+func git(t *testing.T, dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=gopack", "-c", "user.email=gopack@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// Create a git repository to use as a dependency source.
+func createGitRepo(t *testing.T, name string) string {
+	dir, _ := ioutil.TempDir("", "gopack-repo-")
+	repo := path.Join(dir, name)
+	createPath(repo)
+	git(t, repo, "init", "-q", "-b", "master")
+	return repo
+}
+
+// Commit a file to the repository and return the new revision.
+func commitGitFile(t *testing.T, repo, name, content string) string {
+	err := ioutil.WriteFile(path.Join(repo, name), []byte(content), 0644)
+	check(err)
+	git(t, repo, "add", name)
+	git(t, repo, "commit", "-q", "-m", "update "+name)
+	return git(t, repo, "rev-parse", "HEAD")
+}
+
+// Start a project depending on example.com/lib, checked out from the
+// git repo at version, a config line like `branch = "master"`, or at
+// the default branch when version is "".
+func createGitProject(repo, version string) {
+	setupTestPwd()
+	setupEnv()
+
+	config := "\n[deps.lib]\n  import = \"example.com/lib\"\n"
+	if version != "" {
+		config += "  " + version + "\n"
+	}
+	config += fmt.Sprintf("  scm = \"git\"\n  source = \"%s\"\n", repo)
+	createFixtureConfig(pwd, config)
+}
+
+// Start a project depending on the git repo and vendor it
+// like the first run of gopack does.
+func setupGitProject(t *testing.T, repo, version string) (*Config, *Dependencies) {
+	createGitProject(repo, version)
+
+	config, deps := loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(deps))
+	check(config.WriteLock(deps))
+	check(config.WriteFingerprints(deps))
+	return config, deps
+}
+
 func createScmDep(scm string, project string, paths ...string) *Dep {
 	dep := &Dep{Import: project}
 	scmPath := path.Join(dep.Src(), scm)
@@ -92,9 +156,9 @@ func TestTransitiveDependencies(t *testing.T) {
 `
 	createFixtureConfig(pwd, fixture)
 
-	config := NewConfig(pwd)
+	config := loadTestConfig(pwd)
 	dependencies, _ := config.LoadDependencyModel(NewGraph())
-	loadTransitiveDependencies(dependencies)
+	check(loadTransitiveDependencies(dependencies))
 
 	dep := path.Join(pwd, VendorDir, "src", "github.com", "calavera", "testGoPack")
 	if _, err := os.Stat(dep); os.IsNotExist(err) {
@@ -122,7 +186,7 @@ import = "github.com/nu7hatch/gouuid"
   branch = "master"
 `
 	createFixtureConfig(pwd, fixture)
-	config := NewConfig(pwd)
+	config := loadTestConfig(pwd)
 	dependencies, _ := config.LoadDependencyModel(NewGraph())
 	if len(dependencies.DepList) > 2 {
 		t.Fatalf("WHOA buddy, shoulda had 2 deps, had %d instead", len(dependencies.DepList))
@@ -134,7 +198,7 @@ import = "github.com/nu7hatch/gouuid"
 		t.Fatalf("Scm should have been go, was %s", dependencies.DepList[1])
 	}
 
-	loadTransitiveDependencies(dependencies)
+	check(loadTransitiveDependencies(dependencies))
 	dep := path.Join(pwd, VendorDir, "src", "github.com", "calavera", "testGoPack")
 	if _, err := os.Stat(dep); os.IsNotExist(err) {
 		t.Errorf("Expected dependency github.com/calavera/testGoPack to be in vendor %s\n", pwd)
@@ -159,10 +223,537 @@ func TestScmAndSourceRequired(t *testing.T) {
 
 	for _, fixture := range fixtures {
 		createFixtureConfig(pwd, fixture)
-		config := NewConfig(pwd)
+		config := loadTestConfig(pwd)
 		dependencies, err := config.LoadDependencyModel(NewGraph())
 		if err == nil {
 			t.Fatalf("Supposed to have failed due to lacking Source or Scm - %s", dependencies.DepList[0])
 		}
 	}
 }
+
+func TestTransitiveVersionConflict(t *testing.T) {
+	shared := createGitRepo(t, "shared")
+	old := commitGitFile(t, shared, "shared.go", "package shared\n")
+	latest := commitGitFile(t, shared, "shared.go", "package shared\n\nconst Version = 2\n")
+
+	lib := createGitRepo(t, "lib")
+	createFixtureConfig(lib, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, old, shared))
+	git(t, lib, "add", "gopack.config")
+	git(t, lib, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+[deps.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, lib, latest, shared))
+
+	config := loadTestConfig(pwd)
+	dependencies, _ := config.LoadDependencyModel(NewGraph())
+	check(loadTransitiveDependencies(dependencies))
+
+	conflicts := dependencies.ConflictErrors()
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 version conflict, found %d", len(conflicts))
+	}
+
+	msg := conflicts[0].String()
+	if !strings.Contains(msg, config.Path) || !strings.Contains(msg, "example.com/lib/gopack.config") {
+		t.Errorf("Expected the conflict to report both configs, was %s", msg)
+	}
+
+	node := dependencies.ImportGraph.Search("example.com/shared")
+	if node.Dependency.CheckoutSpec != latest {
+		t.Errorf("Expected the root config to win the conflict")
+	}
+
+	revision, _ := node.Dependency.CurrentRevision()
+	if revision != latest {
+		t.Errorf("Expected example.com/shared to be checked out at %s but it was %s", latest, revision)
+	}
+}
+
+func TestSameDepthVersionConflict(t *testing.T) {
+	shared := createGitRepo(t, "shared")
+	first := commitGitFile(t, shared, "shared.go", "package shared\n")
+	second := commitGitFile(t, shared, "shared.go", "package shared\n\nconst Version = 2\n")
+
+	// both libs ask for a different commit of shared
+	libs := make(map[string]string)
+	for name, commit := range map[string]string{"alib": first, "zlib": second} {
+		repo := createGitRepo(t, name)
+		createFixtureConfig(repo, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, commit, shared))
+		git(t, repo, "add", "gopack.config")
+		git(t, repo, "commit", "-q", "-m", "add config")
+		libs[name] = repo
+	}
+
+	// zlib is declared first, alib's config still wins being first by path
+	for _, order := range [][]string{{"zlib", "alib"}, {"alib", "zlib"}} {
+		setupTestPwd()
+		setupEnv()
+		fixture := ""
+		for _, name := range order {
+			fixture += fmt.Sprintf(`
+[deps.%s]
+  import = "example.com/%s"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, name, name, libs[name])
+		}
+		createFixtureConfig(pwd, fixture)
+
+		_, dependencies := loadTestConfiguration(pwd)
+		check(loadTransitiveDependencies(dependencies))
+
+		node := dependencies.ImportGraph.Search("example.com/shared")
+		if node.Dependency.CheckoutSpec != first || !strings.Contains(node.Dependency.Origin, "example.com/alib") {
+			t.Errorf("Expected the config of example.com/alib to win when declared in order %v, but %s won", order, node.Dependency.Origin)
+		}
+	}
+}
+
+func TestPrintDependencyTree(t *testing.T) {
+	shared := createGitRepo(t, "shared")
+	old := commitGitFile(t, shared, "shared.go", "package shared\n")
+	latest := commitGitFile(t, shared, "shared.go", "package shared\n\nconst Version = 2\n")
+
+	lib := createGitRepo(t, "lib")
+	createFixtureConfig(lib, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, old, shared))
+	git(t, lib, "add", "gopack.config")
+	git(t, lib, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+[deps.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, lib, latest, shared))
+
+	config := loadTestConfig(pwd)
+	dependencies, _ := config.LoadDependencyModel(NewGraph())
+	check(loadTransitiveDependencies(dependencies))
+
+	var buf bytes.Buffer
+	dependencies.printRequirements(&buf, "", 0, make(map[string]bool))
+
+	expected := []string{
+		"- example.com/lib @ branch master [gopack.config]",
+		fmt.Sprintf("  - example.com/shared @ commit %s (ignored, using commit %s from %s) [%s/src/example.com/lib/gopack.config]", old, latest, shared, VendorDir),
+		fmt.Sprintf("- example.com/shared @ commit %s [gopack.config]", latest),
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines in the tree but it was\n%s", len(expected), buf.String())
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("Expected line %d to be %q but it was %q", i, expected[i], line)
+		}
+	}
+}
+
+func TestPrintDependencyTreeDuplicates(t *testing.T) {
+	shared := createGitRepo(t, "shared")
+	commitGitFile(t, shared, "shared.go", "package shared\n")
+
+	lib := createGitRepo(t, "lib")
+	createFixtureConfig(lib, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  scm = "git"
+  source = "%s"
+`, shared))
+	git(t, lib, "add", "gopack.config")
+	git(t, lib, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  scm = "git"
+  source = "%s"
+[deps.other]
+  import = "example.com/other"
+  scm = "git"
+  source = "%s"
+`, lib, lib))
+
+	config := loadTestConfig(pwd)
+	dependencies, _ := config.LoadDependencyModel(NewGraph())
+	check(loadTransitiveDependencies(dependencies))
+
+	edges := dependencies.ImportGraph.Requirements("example.com/lib")
+	if len(edges) != 1 || edges[0].Dep.Import != "example.com/shared" {
+		t.Fatalf("Expected example.com/lib to require example.com/shared, was %v", edges)
+	}
+
+	var buf bytes.Buffer
+	dependencies.printRequirements(&buf, "", 0, make(map[string]bool))
+
+	if strings.Count(buf.String(), "example.com/shared @ default branch") != 2 {
+		t.Errorf("Expected example.com/shared under both dependencies, was\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "(ignored") {
+		t.Errorf("Expected no conflict between the same versions, was\n%s", buf.String())
+	}
+}
+
+func TestTransitiveDependencyCycle(t *testing.T) {
+	a := createGitRepo(t, "a")
+	b := createGitRepo(t, "b")
+
+	createFixtureConfig(a, fmt.Sprintf(`
+[deps.b]
+  import = "example.com/b"
+  scm = "git"
+  source = "%s"
+`, b))
+	git(t, a, "add", "gopack.config")
+	git(t, a, "commit", "-q", "-m", "add config")
+
+	createFixtureConfig(b, fmt.Sprintf(`
+[deps.a]
+  import = "example.com/a"
+  scm = "git"
+  source = "%s"
+`, a))
+	git(t, b, "add", "gopack.config")
+	git(t, b, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.a]
+  import = "example.com/a"
+  scm = "git"
+  source = "%s"
+`, a))
+
+	config := loadTestConfig(pwd)
+	dependencies, _ := config.LoadDependencyModel(NewGraph())
+	check(loadTransitiveDependencies(dependencies))
+
+	cycles := dependencies.CycleErrors()
+	if len(cycles) != 1 {
+		t.Fatalf("Expected 1 dependency cycle, found %d", len(cycles))
+	}
+
+	if cycles[0].Kind != DependencyCycle || !strings.Contains(cycles[0].Message, "example.com/a -> example.com/b -> example.com/a") {
+		t.Errorf("Expected the cycle to be reported with its path, was %s", cycles[0].Message)
+	}
+
+	if len(dependencies.Resolved()) != 2 {
+		t.Errorf("Expected both dependencies to be resolved once, found %v", dependencies.Resolved())
+	}
+}
+
+func TestDependencyCycleBackToTheProject(t *testing.T) {
+	a := createGitRepo(t, "a")
+
+	setupTestPwd()
+	setupEnv()
+
+	createFixtureConfig(a, fmt.Sprintf(`
+[deps.app]
+  import = "example.com/app"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, pwd))
+	git(t, a, "add", "gopack.config")
+	git(t, a, "commit", "-q", "-m", "add config")
+
+	createFixtureConfig(pwd, fmt.Sprintf(`
+repo = "example.com/app"
+
+[deps.a]
+  import = "example.com/a"
+  scm = "git"
+  source = "%s"
+`, a))
+
+	config := loadTestConfig(pwd)
+	graph := NewGraph()
+	check(config.InitRepo(graph))
+	dependencies, _ := config.LoadDependencyModel(graph)
+	check(loadTransitiveDependencies(dependencies))
+
+	if conflicts := dependencies.ConflictErrors(); len(conflicts) != 0 {
+		t.Errorf("Expected no conflict with the project, found %v", conflicts[0].Message)
+	}
+
+	cycles := dependencies.CycleErrors()
+	if len(cycles) != 1 || !strings.Contains(cycles[0].Message, "example.com/app -> example.com/a -> example.com/app") {
+		t.Errorf("Expected the cycle back to the project to be reported, found %v", cycles)
+	}
+
+	var buf bytes.Buffer
+	dependencies.printRequirements(&buf, "", 0, make(map[string]bool))
+	if strings.Contains(buf.String(), "(ignored") {
+		t.Errorf("Expected the project not to be ignored in the tree, was\n%s", buf.String())
+	}
+}
+
+func TestRefetchWhenTransitiveConfigChanges(t *testing.T) {
+	shared := createGitRepo(t, "shared")
+	commitGitFile(t, shared, "shared.go", "package shared\n")
+	git(t, shared, "tag", "v1.0.0")
+	commitGitFile(t, shared, "shared.go", "package shared\n\nconst Version = 2\n")
+	git(t, shared, "tag", "v2.0.0")
+
+	lib := createGitRepo(t, "lib")
+	createFixtureConfig(lib, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  tag = "v1.0.0"
+  scm = "git"
+  source = "%s"
+`, shared))
+	git(t, lib, "add", "gopack.config")
+	git(t, lib, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, lib))
+
+	config, dependencies := loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(dependencies))
+	check(config.WriteLock(dependencies))
+	check(config.WriteFingerprints(dependencies))
+
+	// the vendored lib now asks for another version of shared
+	createFixtureConfig(dependencyPath("example.com/lib"), fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  tag = "v2.0.0"
+  scm = "git"
+  source = "%s"
+`, shared))
+
+	config, dependencies = loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(dependencies))
+
+	for _, dep := range dependencies.Resolved() {
+		changed := dep.Import == "example.com/shared"
+		if dep.fetch != changed {
+			t.Errorf("Expected %s to be fetched only if what it resolves to changed", dep.Import)
+		}
+	}
+
+	node := dependencies.ImportGraph.Lookup("example.com/shared")
+	if revision, _ := node.Dependency.CurrentRevision(); revision != git(t, shared, "rev-parse", "v2.0.0^{commit}") {
+		t.Errorf("Expected example.com/shared to be checked out at v2.0.0")
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	for _, tag := range []string{"v1.1.0", "v1.2.0", "v1.2.5", "v1.3.0", "v2.0.0"} {
+		commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = \""+tag+"\"\n")
+		git(t, repo, "tag", tag)
+	}
+	expected := git(t, repo, "rev-parse", "v1.2.5^{commit}")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  version = "~1.2"
+  scm = "git"
+  source = "%s"
+`, repo))
+
+	config := loadTestConfig(pwd)
+	dependencies, err := config.LoadDependencyModel(NewGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dep := dependencies.DepList[0]
+	if dep.CheckoutType() != "version" || !dep.fetch {
+		t.Errorf("Expected a version dependency that needs fetching")
+	}
+
+	check(loadTransitiveDependencies(dependencies))
+
+	revision, _ := dep.CurrentRevision()
+	if revision != expected {
+		t.Errorf("Expected version ~1.2 to check out v1.2.5 (%s) but it was %s", expected, revision)
+	}
+}
+
+func TestUnsatisfiableVersionConstraint(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	git(t, repo, "tag", "v1.0.0")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  version = "^2.0"
+  scm = "git"
+  source = "%s"
+`, repo))
+
+	_, dependencies := loadTestConfiguration(pwd)
+	err := loadTransitiveDependencies(dependencies)
+	if e, ok := err.(*ValidationError); !ok || e.Errors[0].Kind != FetchFailed {
+		t.Fatalf("Expected a version no tag matches to fail the fetch but it was %#v", err)
+	}
+	if code := ExitCode(err); code != ExitScm {
+		t.Errorf("Expected exit code %d but it was %d", ExitScm, code)
+	}
+}
+
+func TestVersionExcludesOtherSpecs(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	fixtures := []string{`
+[deps.lib]
+  import = "github.com/pewp/lib"
+  version = "~1.2"
+  tag = "v1.2.0"`, `
+[deps.lib]
+  import = "github.com/pewp/lib"
+  version = "~1.2"
+  branch = "master"`, `
+[deps.lib]
+  import = "github.com/pewp/lib"
+  version = "latest"`}
+
+	for _, fixture := range fixtures {
+		createFixtureConfig(pwd, fixture)
+		config := loadTestConfig(pwd)
+		if _, err := config.LoadDependencyModel(NewGraph()); err == nil {
+			t.Errorf("Expected an invalid version dependency to fail - %s", fixture)
+		}
+	}
+}
+
+func TestDependencyJSON(t *testing.T) {
+	dep := &Dep{
+		Import:       "github.com/calavera/testGoPack",
+		Scm:          "git",
+		Source:       "https://github.com/calavera/testGoPack.git",
+		CheckoutFlag: TagFlag,
+		CheckoutSpec: "v1.0.0"}
+
+	b, err := json.Marshal(dep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"import":"github.com/calavera/testGoPack","scm":"git","source":"https://github.com/calavera/testGoPack.git","checkout_type":"tag","checkout_spec":"v1.0.0"}`
+	if string(b) != expected {
+		t.Errorf("Expected json to be %s, but was %s\n", expected, b)
+	}
+}
+
+func TestLocalDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	createSourceFixture(path.Join(pwd, "..", path.Base(pwd)+"-mylib"), "lib.go", "package mylib\n")
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "local"
+  source = "../%s-mylib"
+[deps.other]
+  import = "example.com/other"
+  scm = "local"
+  path = "file://%s/../%s-mylib"
+`, path.Base(pwd), pwd, path.Base(pwd)))
+
+	config := loadTestConfig(pwd)
+	dependencies, err := config.LoadDependencyModel(NewGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(loadTransitiveDependencies(dependencies))
+
+	for _, dep := range dependencies.DepList {
+		stat, err := os.Lstat(dep.Src())
+		if err != nil || stat.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Expected %s to be linked in vendor %s", dep.Import, pwd)
+		}
+
+		if _, err := os.Stat(path.Join(dep.Src(), "lib.go")); err != nil {
+			t.Errorf("Expected %s to link to the local directory", dep.Import)
+		}
+	}
+}
+
+func TestInvalidLocalDependency(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	fixtures := []string{`
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "local"
+  source = "../does-not-exist"`, `
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "local"
+  source = "."
+  branch = "master"`, `
+[deps.mylib]
+  import = "example.com/mylib"
+  scm = "local"`}
+
+	for _, fixture := range fixtures {
+		createFixtureConfig(pwd, fixture)
+		config := loadTestConfig(pwd)
+		if _, err := config.LoadDependencyModel(NewGraph()); err == nil {
+			t.Errorf("Expected an invalid local dependency to fail - %s", fixture)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// Outdated lists the releases newer than the tag a dependency is pinned to.
+type Outdated struct {
+	Import  string `json:"import"`
+	Current string `json:"current"`
+	// highest tags with the same major and minor, the same major, and any
+	LatestPatch string `json:"latest_patch,omitempty"`
+	LatestMinor string `json:"latest_minor,omitempty"`
+	LatestMajor string `json:"latest_major,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// gp outdated
+func outdatedCommand() error {
+	config, dependencies, err := loadConfiguration(".")
+	if err != nil {
+		return err
+	}
+	if dependencies == nil {
+		return NoDependenciesError(config)
+	}
+
+	if err := loadVendoredDependencies(dependencies); err != nil {
+		return err
+	}
+
+	report := []*Outdated{}
+	for _, dep := range dependencies.Resolved() {
+		if dep.CheckoutFlag == TagFlag {
+			report = append(report, outdatedDependency(dep))
+		}
+	}
+
+	if format == JSONFormat {
+		return printJSON(struct {
+			Dependencies []*Outdated `json:"dependencies"`
+		}{report})
+	}
+	printOutdated(report)
+	return nil
+}
+
+func outdatedDependency(d *Dep) *Outdated {
+	o := &Outdated{Import: d.Import, Current: d.CheckoutSpec}
+
+	current, err := ParseVersion(d.CheckoutSpec)
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+
+	scm, err := NewScm(d)
+	if err != nil {
+		o.Error = err.Error()
+		return o
+	}
+
+	if !offline {
+		if err = refreshTags(scm, d.Src()); err != nil {
+			o.Error = fmt.Sprintf("can't fetch the tags: %s", err)
+			return o
+		}
+	}
+
+	tags, err := scm.Tags(d.Src())
+	if err != nil {
+		o.Error = fmt.Sprintf("can't list the tags: %s", err)
+		return o
+	}
+
+	o.LatestPatch, o.LatestMinor, o.LatestMajor = newerTags(current, tags)
+	return o
+}
+
+// Bring the tags of the checkout in path up to date, for the
+// scms that fetch without updating the working copy.
+func refreshTags(scm Scm, path string) error {
+	if g, ok := scm.(Go); ok {
+		scm = g.Scm
+	}
+
+	switch scm.(type) {
+	case Git, Hg:
+		return scm.Fetch(path)
+	}
+	return nil
+}
+
+// The highest semantic version tags above current: with the same
+// major and minor, with the same major, and with any major.
+// Pre-releases are left out.
+func newerTags(current *Version, tags []string) (patch, minor, major string) {
+	var latestPatch, latestMinor, latestMajor *Version
+
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || v.Pre != "" || v.Compare(current) <= 0 {
+			continue
+		}
+
+		if v.Major == current.Major && v.Minor == current.Minor && (latestPatch == nil || v.Compare(latestPatch) > 0) {
+			latestPatch = v
+		}
+		if v.Major == current.Major && (latestMinor == nil || v.Compare(latestMinor) > 0) {
+			latestMinor = v
+		}
+		if latestMajor == nil || v.Compare(latestMajor) > 0 {
+			latestMajor = v
+		}
+	}
+
+	return originalTag(latestPatch), originalTag(latestMinor), originalTag(latestMajor)
+}
+
+func originalTag(v *Version) string {
+	if v == nil {
+		return ""
+	}
+	return v.Original
+}
+
+func printOutdated(report []*Outdated) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "IMPORT\tCURRENT\tPATCH\tMINOR\tMAJOR")
+
+	for _, o := range report {
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", o.Import, o.Current,
+			orDash(o.LatestPatch), orDash(o.LatestMinor), orDash(o.LatestMajor))
+		if o.Error != "" {
+			line += "\t" + o.Error
+		}
+		fmt.Fprintln(writer, line)
+	}
+	writer.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNewerTags(t *testing.T) {
+	current, _ := ParseVersion("v1.2.0")
+	tags := []string{"v1.1.0", "v1.2.0", "v1.2.3", "v1.2.10", "v1.4.0", "v2.0.0", "v2.1.0", "v3.0.0-rc.1", "latest"}
+
+	patch, minor, major := newerTags(current, tags)
+	if patch != "v1.2.10" || minor != "v1.4.0" || major != "v2.1.0" {
+		t.Errorf("Expected v1.2.10, v1.4.0 and v2.1.0 but they were %s, %s and %s", patch, minor, major)
+	}
+
+	latest, _ := ParseVersion("v2.1.0")
+	if patch, minor, major = newerTags(latest, tags); patch != "" || minor != "" || major != "" {
+		t.Errorf("Expected no newer tags than v2.1.0 but found %s, %s and %s", patch, minor, major)
+	}
+}
+
+func TestOutdatedDependency(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	for _, tag := range []string{"v1.0.0", "v1.0.1", "v1.1.0"} {
+		commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = \""+tag+"\"\n")
+		git(t, repo, "tag", tag)
+	}
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  tag = "v1.0.0"
+  scm = "git"
+  source = "%s"
+`, repo))
+
+	_, deps := loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(deps))
+
+	// released after the dependency was fetched
+	commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = \"v2.0.0\"\n")
+	git(t, repo, "tag", "v2.0.0")
+
+	o := outdatedDependency(deps.DepList[0])
+	if o.Error != "" {
+		t.Fatal(o.Error)
+	}
+
+	if o.Current != "v1.0.0" || o.LatestPatch != "v1.0.1" || o.LatestMinor != "v1.1.0" || o.LatestMajor != "v2.0.0" {
+		t.Errorf("Expected v1.0.0 to be behind v1.0.1, v1.1.0 and v2.0.0, was %+v", o)
+	}
+}
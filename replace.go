@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"path/filepath"
+)
+
+// Replacements swap every declaration of an import, in the root config
+// and in transitive ones alike, for the scm, source and version of a
+// [replace.<name>] table of the root config. Forks are used that way.
+type Replacements map[string]*Dep
+
+func (c *Config) loadReplacements(t *toml.TomlTree) (Replacements, error) {
+	replacements := Replacements{}
+
+	tree, ok := t.Get("replace").(*toml.TomlTree)
+	if !ok {
+		return replacements, nil
+	}
+
+	for _, k := range c.declared.keys(tree, "replace") {
+		r, ok := tree.Get(k).(*toml.TomlTree)
+		if !ok {
+			return nil, fmt.Errorf("%s - replace.%s must be a table", c.Path, k)
+		}
+		if _, ok := r.Get("import").(string); !ok {
+			return nil, fmt.Errorf("%s - replace.%s needs the import it replaces", c.Path, k)
+		}
+
+		d := c.newDep(r)
+		if err := d.Validate(); err != nil {
+			return nil, err
+		}
+
+		// local paths stay relative to the root config in transitive ones
+		if d.Scm == LocalTag {
+			source, err := filepath.Abs(d.LocalPath())
+			if err != nil {
+				return nil, err
+			}
+			d.Source = source
+		}
+
+		replacements[d.Import] = d
+	}
+	return replacements, nil
+}
+
+// Use the replacement of the dep's import, if there's one.
+func (replacements Replacements) apply(d *Dep) {
+	r, found := replacements[d.Import]
+	if !found {
+		return
+	}
+
+	declared := *d
+	d.Replaces = &declared
+
+	d.Scm = r.Scm
+	d.Source = r.Source
+	d.Sha256 = r.Sha256
+	d.CheckoutFlag = r.CheckoutFlag
+	d.CheckoutSpec = r.CheckoutSpec
+}
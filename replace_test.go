@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pelletier/go-toml"
+	"strings"
+	"testing"
+)
+
+func TestReplaceTransitiveDependency(t *testing.T) {
+	upstream := createGitRepo(t, "shared")
+	commitGitFile(t, upstream, "shared.go", "package shared\n")
+
+	fork := createGitRepo(t, "fork")
+	git(t, fork, "pull", "-q", upstream, "master")
+	patched := commitGitFile(t, fork, "shared.go", "package shared\n\nconst Patched = true\n")
+
+	lib := createGitRepo(t, "lib")
+	createFixtureConfig(lib, fmt.Sprintf(`
+[deps.shared]
+  import = "example.com/shared"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+`, upstream))
+	git(t, lib, "add", "gopack.config")
+	git(t, lib, "commit", "-q", "-m", "add config")
+
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, fmt.Sprintf(`
+[deps.lib]
+  import = "example.com/lib"
+  branch = "master"
+  scm = "git"
+  source = "%s"
+
+[replace.shared]
+  import = "example.com/shared"
+  commit = "%s"
+  scm = "git"
+  source = "%s"
+`, lib, patched, fork))
+
+	config := loadTestConfig(pwd)
+	dependencies, err := config.LoadDependencyModel(NewGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(loadTransitiveDependencies(dependencies))
+
+	if len(dependencies.ImportGraph.Conflicts) != 0 {
+		t.Errorf("Expected no conflicts but found %d", len(dependencies.ImportGraph.Conflicts))
+	}
+
+	dep := dependencies.ImportGraph.Lookup("example.com/shared").Dependency
+	if dep.Source != fork || dep.Replaces == nil || dep.Replaces.Source != upstream {
+		t.Fatalf("Expected example.com/shared to be replaced by the fork, %v", dep)
+	}
+
+	if revision, _ := dep.CurrentRevision(); revision != patched {
+		t.Errorf("Expected example.com/shared to be checked out at %s but it was %s", patched, revision)
+	}
+
+	b, _ := json.Marshal(dep)
+	if !strings.Contains(string(b), fmt.Sprintf(`"replaces":{"import":"example.com/shared","scm":"git","source":"%s"`, upstream)) {
+		t.Errorf("Expected the replaced dependency in %s", b)
+	}
+}
+
+func TestInvalidReplacements(t *testing.T) {
+	setupTestPwd()
+
+	for _, fixture := range []string{`
+[replace]
+  shared = "example.com/fork"`, `
+[replace.shared]
+  scm = "git"
+  source = "https://example.com/fork"`, `
+[replace.shared]
+  import = "example.com/shared"
+  scm = "git"`} {
+		createFixtureConfig(pwd, fixture)
+
+		config := &Config{Path: pwd + "/gopack.config"}
+		tree, _ := toml.LoadFile(config.Path)
+		if _, err := config.loadReplacements(tree); err == nil {
+			t.Errorf("Expected replacements to be invalid - %s", fixture)
+		}
+	}
+}
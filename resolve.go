@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RepoRoot is the repository an import path is checked out from.
+type RepoRoot struct {
+	// import path of the root of the repository, "github.com/gorilla/mux"
+	Root string
+	// scm of the repository, git, hg, svn or bzr
+	Scm string
+	// where to clone the repository from
+	Source string
+}
+
+// A hosting service whose repository roots can be told from the import path.
+type knownHost struct {
+	prefix string
+	// matches the import path, capturing the root of the repository
+	pattern *regexp.Regexp
+	scm     string
+}
+
+var knownHosts = []knownHost{
+	{"github.com/", regexp.MustCompile(`^(github\.com/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/[\p{L}0-9_.\-]+)*$`), GitTag},
+	{"bitbucket.org/", regexp.MustCompile(`^(bitbucket\.org/[A-Za-z0-9_.\-]+/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`), GitTag},
+	{"launchpad.net/", regexp.MustCompile(`^(launchpad\.net/(?:~[A-Za-z0-9_.\-]+/(?:\+junk|[A-Za-z0-9_.\-]+)/[A-Za-z0-9_.\-]+|[A-Za-z0-9_.\-]+))(/[A-Za-z0-9_.\-]+)*$`), BzrTag},
+	{"", regexp.MustCompile(`^([a-z0-9_\-]+\.googlesource\.com/[A-Za-z0-9_.\-]+)(/[A-Za-z0-9_.\-]+)*$`), GitTag},
+}
+
+// Import paths naming their scm, like "example.com/repo.git/sub".
+var scmSuffix = regexp.MustCompile(`^((?:[A-Za-z0-9_.\-]+/)+?[A-Za-z0-9_.\-]+\.(git|hg|svn|bzr))(/[A-Za-z0-9_.\-]+)*$`)
+
+// Resolver maps import paths to repositories the way go get does,
+// from the patterns of known hosts or else from the go-import meta
+// tags served by the host of the import.
+type Resolver struct {
+	Client *http.Client
+
+	mutex sync.Mutex
+	roots map[string]*RepoRoot
+	// imports whose lookup failed, not to ask their host again
+	failed map[string]error
+}
+
+var resolver = NewResolver()
+
+func NewResolver() *Resolver {
+	return &Resolver{
+		Client: &http.Client{Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.DialTimeout(network, addr, 30*time.Second)
+			},
+			ResponseHeaderTimeout: 30 * time.Second}},
+		roots:  make(map[string]*RepoRoot),
+		failed: make(map[string]error)}
+}
+
+// Resolve finds the repository importPath belongs to.
+func (r *Resolver) Resolve(importPath string) (*RepoRoot, error) {
+	if root, err := r.cached(importPath); root != nil || err != nil {
+		return root, err
+	}
+
+	root := staticRepoRoot(importPath)
+	if root == nil {
+		if offline {
+			return nil, fmt.Errorf("can't find the repository of %s offline", importPath)
+		}
+
+		var err error
+		if root, err = r.discover(importPath); err != nil {
+			r.mutex.Lock()
+			r.failed[importPath] = err
+			r.mutex.Unlock()
+			return nil, err
+		}
+	}
+
+	r.mutex.Lock()
+	r.roots[root.Root] = root
+	r.mutex.Unlock()
+
+	return root, nil
+}
+
+// The repository already resolved for importPath or one of its parents,
+// or the error looking it up failed with before.
+func (r *Resolver) cached(importPath string) (*RepoRoot, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for p := importPath; p != "." && p != "/" && p != ""; p = parentImport(p) {
+		if root, found := r.roots[p]; found {
+			return root, nil
+		}
+	}
+	return nil, r.failed[importPath]
+}
+
+func parentImport(importPath string) string {
+	if i := strings.LastIndex(importPath, "/"); i >= 0 {
+		return importPath[:i]
+	}
+	return ""
+}
+
+// The repository of imports from known hosts or naming their scm.
+func staticRepoRoot(importPath string) *RepoRoot {
+	for _, host := range knownHosts {
+		if !strings.HasPrefix(importPath, host.prefix) {
+			continue
+		}
+		if m := host.pattern.FindStringSubmatch(importPath); m != nil {
+			return &RepoRoot{Root: m[1], Scm: host.scm, Source: "https://" + m[1]}
+		}
+	}
+
+	if m := scmSuffix.FindStringSubmatch(importPath); m != nil {
+		return &RepoRoot{Root: m[1], Scm: m[2], Source: "https://" + m[1]}
+	}
+	return nil
+}
+
+// Ask the host of the import for its go-import meta tags.
+func (r *Resolver) discover(importPath string) (*RepoRoot, error) {
+	url := fmt.Sprintf("https://%s?go-get=1", importPath)
+
+	resp, err := r.Client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("can't find the repository of %s: %s", importPath, err)
+	}
+	defer resp.Body.Close()
+
+	imports, err := parseMetaGoImports(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse the go-import meta tags of %s: %s", url, err)
+	}
+
+	var match *metaImport
+	for i, m := range imports {
+		if m.Prefix != importPath && !strings.HasPrefix(importPath, m.Prefix+"/") {
+			continue
+		}
+		if match != nil {
+			return nil, fmt.Errorf("%s has more than one go-import meta tag for %s", url, importPath)
+		}
+		match = &imports[i]
+	}
+
+	if match == nil {
+		return nil, fmt.Errorf("%s has no go-import meta tag for %s", url, importPath)
+	}
+	if _, found := Scms[match.Scm]; !found {
+		return nil, fmt.Errorf("%s is in a %s repository, which gopack doesn't support", importPath, match.Scm)
+	}
+
+	return &RepoRoot{Root: match.Prefix, Scm: match.Scm, Source: match.Source}, nil
+}
+
+// <meta name="go-import" content="prefix scm source">
+type metaImport struct {
+	Prefix string
+	Scm    string
+	Source string
+}
+
+// Collect the go-import meta tags in the head of an html page.
+func parseMetaGoImports(r io.Reader) ([]metaImport, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode %s", charset)
+	}
+
+	imports := []metaImport{}
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") || attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			imports = append(imports, metaImport{f[0], f[1], f[2]})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
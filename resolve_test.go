@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStaticRepoRoot(t *testing.T) {
+	expected := map[string]RepoRoot{
+		"github.com/gorilla/mux":                  {"github.com/gorilla/mux", GitTag, "https://github.com/gorilla/mux"},
+		"github.com/bradfitz/gomemcache/memcache": {"github.com/bradfitz/gomemcache", GitTag, "https://github.com/bradfitz/gomemcache"},
+		"bitbucket.org/user/repo/sub":             {"bitbucket.org/user/repo", GitTag, "https://bitbucket.org/user/repo"},
+		"launchpad.net/goyaml":                    {"launchpad.net/goyaml", BzrTag, "https://launchpad.net/goyaml"},
+		"launchpad.net/~user/project/branch/sub":  {"launchpad.net/~user/project/branch", BzrTag, "https://launchpad.net/~user/project/branch"},
+		"go.googlesource.com/tools/go/ast":        {"go.googlesource.com/tools", GitTag, "https://go.googlesource.com/tools"},
+		"example.com/repo.git/sub":                {"example.com/repo.git", GitTag, "https://example.com/repo.git"},
+	}
+
+	for importPath, root := range expected {
+		r := staticRepoRoot(importPath)
+		if r == nil || *r != root {
+			t.Errorf("Expected %s to be in %v but it was in %v", importPath, root, r)
+		}
+	}
+
+	for _, importPath := range []string{"github.com/gorilla", "example.com/vanity/pkg"} {
+		if r := staticRepoRoot(importPath); r != nil {
+			t.Errorf("Expected %s not to be resolved statically but it was %v", importPath, r)
+		}
+	}
+}
+
+func serveGoImports(metas ...string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("go-get") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprintln(w, "<!DOCTYPE html>\n<html>\n<head>")
+		for _, m := range metas {
+			fmt.Fprintf(w, `<meta name="go-import" content="%s">`+"\n", strings.Replace(m, "HOST", r.Host, -1))
+		}
+		fmt.Fprintln(w, "</head>\n<body>go get it</body>\n</html>")
+	}))
+	return server, &requests
+}
+
+func testResolver(server *httptest.Server) (*Resolver, string) {
+	r := NewResolver()
+	r.Client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	return r, strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestDiscoverRepoRoot(t *testing.T) {
+	server, requests := serveGoImports(
+		"HOST/other git https://example.com/other.git",
+		"HOST/vanity hg https://example.com/vanity")
+	defer server.Close()
+	r, host := testResolver(server)
+
+	root, err := r.Resolve(host + "/vanity/pkg/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := RepoRoot{host + "/vanity", HgTag, "https://example.com/vanity"}
+	if *root != expected {
+		t.Errorf("Expected %v but it was %v", expected, root)
+	}
+
+	if _, err := r.Resolve(host + "/vanity/other"); err != nil || *requests != 1 {
+		t.Errorf("Expected packages of the same repository to be resolved once, %d requests", *requests)
+	}
+}
+
+func TestDiscoverRepoRootErrors(t *testing.T) {
+	fixtures := [][]string{
+		{},
+		{"HOST/elsewhere git https://example.com/elsewhere.git"},
+		{"HOST/vanity git https://example.com/a.git", "HOST/vanity/pkg git https://example.com/b.git"},
+		{"HOST/vanity fossil https://example.com/vanity"},
+	}
+
+	for _, metas := range fixtures {
+		server, _ := serveGoImports(metas...)
+		r, host := testResolver(server)
+
+		if root, err := r.Resolve(host + "/vanity/pkg"); err == nil {
+			t.Errorf("Expected %v not to resolve but it was %v", metas, root)
+		}
+		server.Close()
+	}
+}
+
+func TestParseMetaGoImports(t *testing.T) {
+	imports, err := parseMetaGoImports(strings.NewReader(`<html><head>
+<meta charset="utf-8">
+<meta name="go-import" content="example.com/a git https://example.com/a.git">
+<meta name="go-source" content="example.com/a _ _ _">
+</head><body>
+<meta name="go-import" content="example.com/b git https://example.com/b.git">
+</body></html>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imports) != 1 || imports[0] != (metaImport{"example.com/a", GitTag, "https://example.com/a.git"}) {
+		t.Errorf("Expected only the go-import meta tag in head but found %v", imports)
+	}
+}
+
+func TestValidateImportsFromTheSameRepository(t *testing.T) {
+	dependencies := &Dependencies{ImportGraph: NewGraph()}
+	dep := NewDependency("github.com/a/b/sub")
+	dependencies.ImportGraph.Insert(dep)
+	dependencies.DepList = []*Dep{dep}
+
+	p := NewProjectStats()
+	for _, i := range []string{"github.com/a/b", "github.com/a/b/other"} {
+		p.ImportStatsByPath[i] = NewImportStats(i, token.Position{})
+	}
+
+	if errors := dependencies.Validate(p); len(errors) != 0 {
+		t.Errorf("Expected imports from the repository of a dependency to be managed, %v", errors)
+	}
+
+	p.ImportStatsByPath["github.com/a/c"] = NewImportStats("github.com/a/c", token.Position{})
+	if errors := dependencies.Validate(p); len(errors) != 1 || errors[0].Import != "github.com/a/c" {
+		t.Errorf("Expected github.com/a/c to be unmanaged, %v", errors)
+	}
+}
+
+func TestSameRepositoryLookups(t *testing.T) {
+	server, requests := serveGoImports("HOST/vanity git https://example.com/vanity.git")
+	defer server.Close()
+	r, host := testResolver(server)
+	defer func(saved *Resolver) { resolver, offline = saved, false }(resolver)
+	resolver = r
+
+	dependencies := &Dependencies{ImportGraph: NewGraph()}
+	dependencies.ImportGraph.Insert(NewDependency(host + "/vanity/sub"))
+	dependencies.ImportGraph.Insert(NewDependency("github.com/a/b"))
+
+	if dependencies.sameRepository("example.com/other") != nil || *requests != 0 {
+		t.Errorf("Expected imports from hosts without dependencies not to be looked up, %d requests", *requests)
+	}
+
+	offline = true
+	if dependencies.sameRepository(host+"/vanity/other") != nil || *requests != 0 {
+		t.Errorf("Expected imports not to be looked up offline, %d requests", *requests)
+	}
+
+	offline = false
+	for i := 0; i < 2; i++ {
+		if dep := dependencies.sameRepository(host + "/vanity/other"); dep == nil || dep.Import != host+"/vanity/sub" {
+			t.Errorf("Expected %s/vanity/other to be in the repository of %s/vanity/sub", host, host)
+		}
+		dependencies.sameRepository(host + "/missing")
+	}
+	if *requests != 2 {
+		t.Errorf("Expected each import to be looked up once, %d requests", *requests)
+	}
+}
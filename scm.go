@@ -7,6 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -15,6 +18,7 @@ const (
 	HgTag     = "hg"
 	SvnTag    = "svn"
 	BzrTag    = "bzr"
+	LocalTag  = "local"
 	HiddenGit = ".git"
 	HiddenHg  = ".hg"
 	HiddenSvn = ".svn"
@@ -26,6 +30,17 @@ type Scm interface {
 	Checkout(d *Dep) error
 	Fetch(path string) error
 	DownloadCommand(source, path string) *exec.Cmd
+	// Revision returns the revision checked out in path.
+	Revision(path string) (string, error)
+	// Tags lists the tags of the repository in path.
+	Tags(path string) ([]string, error)
+	// Modified lists the changes to the working copy in path,
+	// with the status the scm gives them.
+	Modified(path string) ([]string, error)
+	// Behind asks the remote how many revisions of branch, or of
+	// the default branch when it's empty, the working copy in path
+	// is missing. The working copy itself is left alone.
+	Behind(path, branch string) (int, error)
 }
 
 func dependencyPath(importPath string) string {
@@ -43,10 +58,12 @@ func downloadDependency(d *Dep, depPath, scmType string, scm Scm) (err error) {
 		err = scm.Fetch(depPath)
 	} else if err != nil && !os.IsNotExist(err) {
 		err = fmt.Errorf("Error while examining dependency path for %s: %s", d.Import, err)
+	} else if cached, ok := scm.(cachedScm); ok && cacheDir() != "" {
+		err = downloadThroughCache(d, depPath, cached)
 	} else {
-		fmtcolor(Gray, "downloading %s\n", d.Source)
+		d.printf(Gray, "downloading %s\n", d.DownloadSource())
 
-		cmd := scm.DownloadCommand(d.Source, depPath)
+		cmd := scm.DownloadCommand(d.DownloadSource(), depPath)
 
 		if err = cmd.Run(); err != nil {
 			return fmt.Errorf("Error downloading dependency: %s", err)
@@ -66,14 +83,59 @@ func initScm(d *Dep, scmType string, scm Scm) error {
 	}
 }
 
-func runInPath(path string, fn func() error) error {
-	err := os.Chdir(path)
+// Build a command that runs in dir instead of the current
+// working directory, so several of them can run at once.
+func commandInPath(dir string, name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// Run the command in path and return the first field of every output line.
+func fieldsInPath(path string, name string, args ...string) ([]string, error) {
+	out, err := outputInPath(path, name, args...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	fields := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			fields = append(fields, f[0])
+		}
+	}
+	return fields, nil
+}
+
+// Run the command in path and parse its output as a number.
+func countInPath(path string, name string, args ...string) (int, error) {
+	out, err := outputInPath(path, name, args...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+// Run the command in path and return every non empty output line.
+func linesInPath(path string, name string, args ...string) ([]string, error) {
+	out, err := outputInPath(path, name, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(out, "\n") {
+		if f := strings.Fields(line); len(f) > 0 {
+			lines = append(lines, strings.Join(f, " "))
+		}
 	}
-	defer os.Chdir(pwd)
+	return lines, nil
+}
 
-	return fn()
+// Run the command in path and return its trimmed output.
+func outputInPath(path string, name string, args ...string) (string, error) {
+	b, err := commandInPath(path, name, args...).Output()
+	return strings.TrimSpace(string(b)), err
 }
 
 type Git struct{}
@@ -87,14 +149,60 @@ func (g Git) DownloadCommand(source, path string) *exec.Cmd {
 }
 
 func (g Git) Checkout(d *Dep) error {
-	cmd := exec.Command("git", "checkout", d.CheckoutSpec)
-	return cmd.Run()
+	cmd := commandInPath(d.Src(), "git", "checkout", d.CheckoutSpec)
+	if err := cmd.Run(); err != nil || d.CheckoutFlag != BranchFlag {
+		return err
+	}
+
+	// move the local branch forward to what was last fetched
+	return commandInPath(d.Src(), "git", "merge", "--ff-only", "@{upstream}").Run()
 }
 
 func (g Git) Fetch(path string) error {
-	return runInPath(path, func() error {
-		return exec.Command("git", "fetch").Run()
-	})
+	// checkouts made from the cache fetch through it
+	if origin, err := outputInPath(path, "git", "config", "--get", "remote.origin.url"); err == nil && inCache(origin) {
+		if err = g.UpdateCache("", origin); err != nil {
+			return err
+		}
+	}
+	return commandInPath(path, "git", "fetch").Run()
+}
+
+// The cache holds a mirror of the repository with all its branches and tags.
+func (g Git) UpdateCache(source, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return commandInPath(dir, "git", "fetch", "--prune").Run()
+	}
+	return exec.Command("git", "clone", "--mirror", source, dir).Run()
+}
+
+// Checkouts are local clones of the mirror, sharing its objects through hard links.
+func (g Git) CloneCache(dir, path string) error {
+	return exec.Command("git", "clone", dir, path).Run()
+}
+
+func (g Git) Revision(path string) (string, error) {
+	return outputInPath(path, "git", "rev-parse", "HEAD")
+}
+
+func (g Git) Tags(path string) ([]string, error) {
+	return fieldsInPath(path, "git", "tag", "-l")
+}
+
+func (g Git) Modified(path string) ([]string, error) {
+	return linesInPath(path, "git", "status", "--porcelain")
+}
+
+func (g Git) Behind(path, branch string) (int, error) {
+	if err := g.Fetch(path); err != nil {
+		return 0, err
+	}
+
+	upstream := "origin/HEAD"
+	if branch != "" {
+		upstream = "origin/" + branch
+	}
+	return countInPath(path, "git", "rev-list", "--count", "HEAD.."+upstream)
 }
 
 type Hg struct{}
@@ -111,18 +219,57 @@ func (h Hg) Checkout(d *Dep) error {
 	var cmd *exec.Cmd
 
 	if d.CheckoutFlag == CommitFlag {
-		cmd = exec.Command("hg", "update", "-c", d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "hg", "update", "-c", d.CheckoutSpec)
 	} else {
-		cmd = exec.Command("hg", "checkout", d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "hg", "checkout", d.CheckoutSpec)
 	}
 
 	return cmd.Run()
 }
 
 func (h Hg) Fetch(path string) error {
-	return runInPath(path, func() error {
-		return exec.Command("hg", "pull").Run()
-	})
+	// checkouts made from the cache share its store, pulling into it is enough
+	if origin, err := outputInPath(path, "hg", "paths", "default"); err == nil && inCache(origin) {
+		return h.UpdateCache("", origin)
+	}
+	return commandInPath(path, "hg", "pull").Run()
+}
+
+// The cache holds a clone of the repository without working copy.
+func (h Hg) UpdateCache(source, dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return commandInPath(dir, "hg", "pull").Run()
+	}
+	return exec.Command("hg", "clone", "-U", source, dir).Run()
+}
+
+// Checkouts share the store of the cached clone.
+func (h Hg) CloneCache(dir, path string) error {
+	return exec.Command("hg", "--config", "extensions.share=", "share", dir, path).Run()
+}
+
+func (h Hg) Revision(path string) (string, error) {
+	return outputInPath(path, "hg", "log", "-r", ".", "--template", "{node}")
+}
+
+func (h Hg) Tags(path string) ([]string, error) {
+	return fieldsInPath(path, "hg", "tags", "-q")
+}
+
+func (h Hg) Modified(path string) ([]string, error) {
+	return linesInPath(path, "hg", "status")
+}
+
+func (h Hg) Behind(path, branch string) (int, error) {
+	if err := h.Fetch(path); err != nil {
+		return 0, err
+	}
+
+	if branch == "" {
+		branch = "default"
+	}
+	nodes, err := fieldsInPath(path, "hg", "log", "-r", fmt.Sprintf("only(%s, .)", branch), "--template", "{node}\n")
+	return len(nodes), err
 }
 
 type Svn struct {
@@ -141,20 +288,64 @@ func (s Svn) Checkout(d *Dep) error {
 
 	switch d.CheckoutFlag {
 	case CommitFlag:
-		cmd = exec.Command("svn", "up", "-r", d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "svn", "up", "-r", d.CheckoutSpec)
 	case BranchFlag:
-		cmd = exec.Command("svn", "switch", "^/branches/"+d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "svn", "switch", "^/branches/"+d.CheckoutSpec)
 	case TagFlag:
-		cmd = exec.Command("svn", "switch", "^/tags/"+d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "svn", "switch", "^/tags/"+d.CheckoutSpec)
 	}
 
 	return cmd.Run()
 }
 
 func (s Svn) Fetch(path string) error {
-	return runInPath(path, func() error {
-		return exec.Command("svn", "update").Run()
-	})
+	return commandInPath(path, "svn", "update").Run()
+}
+
+func (s Svn) Revision(path string) (string, error) {
+	info, err := outputInPath(path, "svn", "info")
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(info, "\n") {
+		if strings.HasPrefix(line, "Revision: ") {
+			return strings.TrimPrefix(line, "Revision: "), nil
+		}
+	}
+	return "", fmt.Errorf("no revision found in svn info for %s", path)
+}
+
+func (s Svn) Tags(path string) ([]string, error) {
+	tags, err := fieldsInPath(path, "svn", "ls", "^/tags")
+	for i, t := range tags {
+		tags[i] = strings.TrimSuffix(t, "/")
+	}
+	return tags, err
+}
+
+func (s Svn) Modified(path string) ([]string, error) {
+	return linesInPath(path, "svn", "status")
+}
+
+// The working copy is already switched to the branch.
+func (s Svn) Behind(path, branch string) (int, error) {
+	revisions, err := fieldsInPath(path, "svn", "log", "-q", "-r", "BASE:HEAD")
+	if err != nil {
+		return 0, err
+	}
+
+	behind := 0
+	for _, r := range revisions {
+		if strings.HasPrefix(r, "r") {
+			behind++
+		}
+	}
+	// the log includes the revision checked out
+	if behind > 0 {
+		behind--
+	}
+	return behind, nil
 }
 
 type Bzr struct {
@@ -173,20 +364,101 @@ func (b Bzr) Checkout(d *Dep) error {
 
 	switch d.CheckoutFlag {
 	case CommitFlag:
-		cmd = exec.Command("bzr", "update", "-r", d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "bzr", "update", "-r", d.CheckoutSpec)
 	case BranchFlag:
-		cmd = exec.Command("bzr", "update", "-r", "branch:"+d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "bzr", "update", "-r", "branch:"+d.CheckoutSpec)
 	case TagFlag:
-		cmd = exec.Command("bzr", "update", "-r", "tag:"+d.CheckoutSpec)
+		cmd = commandInPath(d.Src(), "bzr", "update", "-r", "tag:"+d.CheckoutSpec)
 	}
 
 	return cmd.Run()
 }
 
 func (b Bzr) Fetch(path string) error {
-	return runInPath(path, func() error {
-		return exec.Command("bzr", "pull").Run()
-	})
+	return commandInPath(path, "bzr", "pull").Run()
+}
+
+func (b Bzr) Revision(path string) (string, error) {
+	return outputInPath(path, "bzr", "revno")
+}
+
+func (b Bzr) Tags(path string) ([]string, error) {
+	return fieldsInPath(path, "bzr", "tags")
+}
+
+func (b Bzr) Modified(path string) ([]string, error) {
+	return linesInPath(path, "bzr", "status", "--short")
+}
+
+var bzrMissing = regexp.MustCompile(`You are missing (\d+) revision`)
+
+func (b Bzr) Behind(path, branch string) (int, error) {
+	// bzr missing exits with 1 when there's anything missing
+	out, _ := outputInPath(path, "bzr", "missing", "--theirs-only")
+	if m := bzrMissing.FindStringSubmatch(out); m != nil {
+		return strconv.Atoi(m[1])
+	}
+	if strings.Contains(out, "up to date") {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("can't tell what %s is missing: %s", path, out)
+}
+
+// The Local scm links a directory from the local filesystem into the
+// vendor dir, so changes to it are picked up right away. It never
+// checks out a revision, the directory is used as it is.
+type Local struct{}
+
+func (l Local) Init(d *Dep) error {
+	source, err := filepath.Abs(d.LocalPath())
+	if err != nil {
+		return err
+	}
+
+	link := dependencyPath(d.Import)
+	if target, err := os.Readlink(link); err == nil && target == source {
+		return nil
+	}
+
+	// whatever was vendored for this import before is replaced
+	if err := os.RemoveAll(link); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return fmt.Errorf("Error creating import dir %s", err)
+	}
+
+	d.printf(Gray, "linking %s\n", source)
+	return os.Symlink(source, link)
+}
+
+func (l Local) DownloadCommand(source, path string) *exec.Cmd {
+	return exec.Command("ln", "-s", source, path)
+}
+
+func (l Local) Checkout(d *Dep) error {
+	return nil
+}
+
+func (l Local) Fetch(path string) error {
+	return nil
+}
+
+// Local directories aren't pinned to revisions.
+func (l Local) Revision(path string) (string, error) {
+	return "", nil
+}
+
+func (l Local) Tags(path string) ([]string, error) {
+	return nil, nil
+}
+
+func (l Local) Modified(path string) ([]string, error) {
+	return nil, nil
+}
+
+func (l Local) Behind(path, branch string) (int, error) {
+	return 0, nil
 }
 
 // The Go scm embeds another scm and only implements Init so that
@@ -203,6 +475,48 @@ func (g Go) DownloadCommand(source, path string) *exec.Cmd {
 	return exec.Command("go", "get", "-d", "-u", source)
 }
 
+func (g Go) Fetch(path string) error {
+	if g.Scm == nil {
+		return fmt.Errorf("unknown scm for %s", path)
+	}
+	return g.Scm.Fetch(path)
+}
+
+func (g Go) Checkout(d *Dep) error {
+	if g.Scm == nil {
+		return fmt.Errorf("unknown scm for %s", d.Src())
+	}
+	return g.Scm.Checkout(d)
+}
+
+func (g Go) Revision(path string) (string, error) {
+	if g.Scm == nil {
+		return "", fmt.Errorf("unknown scm for %s", path)
+	}
+	return g.Scm.Revision(path)
+}
+
+func (g Go) Tags(path string) ([]string, error) {
+	if g.Scm == nil {
+		return nil, fmt.Errorf("unknown scm for %s", path)
+	}
+	return g.Scm.Tags(path)
+}
+
+func (g Go) Modified(path string) ([]string, error) {
+	if g.Scm == nil {
+		return nil, fmt.Errorf("unknown scm for %s", path)
+	}
+	return g.Scm.Modified(path)
+}
+
+func (g Go) Behind(path, branch string) (int, error) {
+	if g.Scm == nil {
+		return 0, fmt.Errorf("unknown scm for %s", path)
+	}
+	return g.Scm.Behind(path, branch)
+}
+
 func NewScm(d *Dep) (Scm, error) {
 	switch d.Scm {
 	case GitTag:
@@ -211,6 +525,10 @@ func NewScm(d *Dep) (Scm, error) {
 		return Scms[HgTag], nil
 	case SvnTag:
 		return Scms[SvnTag], nil
+	case LocalTag:
+		return Local{}, nil
+	case ArchiveTag:
+		return Archive{}, nil
 	}
 
 	scm := scmInSource(d)
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version parsed from a tag like "v1.2.3".
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// pre-release identifiers, "rc.1" in "1.0.0-rc.1"
+	Pre string
+	// the tag this version was parsed from
+	Original string
+}
+
+// Constraint is a list of comparisons a version must satisfy,
+// written like "~1.2" or ">=1.4, <2.0".
+type Constraint []comparison
+
+type comparison struct {
+	op      string
+	version *Version
+}
+
+func ParseVersion(s string) (*Version, error) {
+	v, parts, err := parsePartialVersion(s)
+	if err != nil {
+		return nil, err
+	}
+	if parts != 3 && v.Pre != "" {
+		return nil, fmt.Errorf("%s is not a semantic version", s)
+	}
+	return v, nil
+}
+
+// Parse a version where minor and patch may be missing,
+// returning how many of major, minor and patch were given.
+func parsePartialVersion(s string) (*Version, int, error) {
+	v := &Version{Original: s}
+
+	str := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if i := strings.Index(str, "+"); i >= 0 {
+		str = str[:i]
+	}
+	if i := strings.Index(str, "-"); i >= 0 {
+		v.Pre = str[i+1:]
+		str = str[:i]
+		if v.Pre == "" {
+			return nil, 0, fmt.Errorf("%s is not a semantic version", s)
+		}
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return nil, 0, fmt.Errorf("%s is not a semantic version", s)
+	}
+
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, 0, fmt.Errorf("%s is not a semantic version", s)
+		}
+		*numbers[i] = n
+	}
+
+	return v, len(parts), nil
+}
+
+// Compare returns -1, 0 or 1 when v is lower, equal or greater than other.
+func (v *Version) Compare(other *Version) int {
+	if c := compareInt(v.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(v.Patch, other.Patch); c != 0 {
+		return c
+	}
+	return comparePre(v.Pre, other.Pre)
+}
+
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s = s + "-" + v.Pre
+	}
+	return s
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// A version without pre-release is greater than one with it,
+// otherwise identifiers are compared one by one.
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] < bs[i]:
+			return -1
+		case as[i] > bs[i]:
+			return 1
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{}
+
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			return nil, fmt.Errorf("invalid version constraint %q", s)
+		}
+
+		op := ""
+		for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+			if strings.HasPrefix(field, o) {
+				op = o
+				break
+			}
+		}
+
+		v, parts, err := parsePartialVersion(strings.TrimSpace(field[len(op):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %s", s, err)
+		}
+
+		c = append(c, expandComparison(op, v, parts)...)
+	}
+
+	return c, nil
+}
+
+// Turn ranges like "~1.2" or "1.2" into plain comparisons.
+func expandComparison(op string, v *Version, parts int) []comparison {
+	upper := &Version{}
+
+	switch {
+	case op == "~" && parts == 1, op == "^" && v.Major > 0, (op == "" || op == "=") && parts == 1:
+		upper.Major = v.Major + 1
+	case op == "~", op == "^" && (v.Minor > 0 || parts == 2), (op == "" || op == "=") && parts == 2:
+		upper.Major, upper.Minor = v.Major, v.Minor+1
+	case op == "^" && parts == 1:
+		upper.Major = 1
+	case op == "^":
+		upper.Major, upper.Minor, upper.Patch = v.Major, v.Minor, v.Patch+1
+	case op == "":
+		return []comparison{{"=", v}}
+	default:
+		return []comparison{{op, v}}
+	}
+
+	return []comparison{{">=", v}, {"<", upper}}
+}
+
+// Check tells whether the version satisfies every comparison.
+// Pre-release versions only match comparisons naming a pre-release
+// of the same major, minor and patch.
+func (c Constraint) Check(v *Version) bool {
+	allowPre := v.Pre == ""
+
+	for _, cmp := range c {
+		if !cmp.matches(v) {
+			return false
+		}
+		if cmp.version.Pre != "" && cmp.version.Major == v.Major &&
+			cmp.version.Minor == v.Minor && cmp.version.Patch == v.Patch {
+			allowPre = true
+		}
+	}
+	return allowPre
+}
+
+func (cmp comparison) matches(v *Version) bool {
+	r := v.Compare(cmp.version)
+
+	switch cmp.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	}
+	return false
+}
+
+// LatestMatching picks the highest tag satisfying the constraint,
+// ignoring tags that are not semantic versions.
+func (c Constraint) LatestMatching(tags []string) (string, bool) {
+	var latest *Version
+
+	for _, tag := range tags {
+		v, err := ParseVersion(tag)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if latest == nil || v.Compare(latest) > 0 {
+			latest = v
+		}
+	}
+
+	if latest == nil {
+		return "", false
+	}
+	return latest.Original, true
+}
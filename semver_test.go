@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := ParseVersion("v1.2.3-rc.1+build")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Major != 1 || v.Minor != 2 || v.Patch != 3 || v.Pre != "rc.1" {
+		t.Errorf("Expected version 1.2.3-rc.1 but it was %s", v)
+	}
+
+	if v.Original != "v1.2.3-rc.1+build" {
+		t.Errorf("Expected to keep the original tag")
+	}
+
+	for _, tag := range []string{"tip", "release-1", "1.2.3.4", "v1.x"} {
+		if _, err := ParseVersion(tag); err == nil {
+			t.Errorf("Expected %s to not be a semantic version", tag)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"0.9.0", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.2", "v1.10.0"}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := ParseVersion(ordered[i])
+		b, _ := ParseVersion(ordered[i+1])
+
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("Expected %s to be lower than %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	checks := []struct {
+		constraint string
+		version    string
+		matches    bool
+	}{
+		{"~1.2", "1.2.0", true},
+		{"~1.2", "1.2.9", true},
+		{"~1.2", "1.3.0", false},
+		{"~1.2.3", "1.2.2", false},
+		{"~1", "1.9.0", true},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^0.2.1", "0.2.5", true},
+		{"^0.2.1", "0.3.0", false},
+		{">=1.4, <2.0", "1.4.0", true},
+		{">=1.4, <2.0", "1.9.9", true},
+		{">=1.4, <2.0", "2.0.0", false},
+		{">=1.4, <2.0", "2.0.0-rc.1", false},
+		{">=1.4, <2.0", "1.3.9", false},
+		{"1.2", "1.2.7", true},
+		{"1.2.3", "1.2.3", true},
+		{"!=1.2.3", "1.2.3", false},
+		{">=1.0.0-rc.1", "1.0.0-rc.2", true},
+		{">=1.0.0", "1.1.0-rc.1", false},
+	}
+
+	for _, c := range checks {
+		constraint, err := ParseConstraint(c.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		v, _ := ParseVersion(c.version)
+		if constraint.Check(v) != c.matches {
+			t.Errorf("Expected %s matching %s to be %v", c.version, c.constraint, c.matches)
+		}
+	}
+}
+
+func TestInvalidConstraints(t *testing.T) {
+	for _, c := range []string{"", "~", ">=1.4,", "latest", ">=x.y"} {
+		if _, err := ParseConstraint(c); err == nil {
+			t.Errorf("Expected %q to be an invalid constraint", c)
+		}
+	}
+}
+
+func TestLatestMatching(t *testing.T) {
+	constraint, _ := ParseConstraint("~1.2")
+	tags := []string{"v1.1.0", "v1.2.0", "v1.2.10", "v1.2.9", "v1.3.0", "v1.2.11-rc.1", "tip"}
+
+	tag, found := constraint.LatestMatching(tags)
+	if !found || tag != "v1.2.10" {
+		t.Errorf("Expected to pick v1.2.10 but picked %s", tag)
+	}
+
+	constraint, _ = ParseConstraint(">=2.0")
+	if _, found := constraint.LatestMatching(tags); found {
+		t.Errorf("Expected no tag to match >=2.0")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"go/ast"
 	"go/parser"
@@ -29,6 +30,24 @@ type SummaryItem struct {
 	Path   string
 }
 
+func (i SummaryItem) OriginName() string {
+	switch i.Origin {
+	case 1:
+		return "remote"
+	case 0:
+		return "local"
+	}
+	return "stdlib"
+}
+
+func (i SummaryItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Origin string `json:"origin"`
+		Path   string `json:"path"`
+		Count  int    `json:"count"`
+	}{i.OriginName(), i.Path, i.Sum})
+}
+
 func (i SummaryItem) Legend() string {
 	var origin string
 
@@ -142,6 +161,12 @@ func (ps *ProjectStats) PrintSummary() {
 	writer.Flush()
 }
 
+func (ps *ProjectStats) PrintSummaryJSON() error {
+	return printJSON(struct {
+		Imports []SummaryItem `json:"imports"`
+	}{ps.GetSummary().Items})
+}
+
 func (ps *ProjectStats) GetSummary() *Summary {
 	summary := &Summary{Items: []SummaryItem{}}
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -197,3 +198,17 @@ func checkSumaryItem(t *testing.T, item SummaryItem, path, legend string) {
 		t.Errorf("Expected legend to be %s, but was %s\n", legend, actual)
 	}
 }
+
+func TestSummaryItemJSON(t *testing.T) {
+	item := SummaryItem{Origin: 1, Sum: 2, Path: "github.com/pelletier/go-toml"}
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"origin":"remote","path":"github.com/pelletier/go-toml","count":2}`
+	if string(b) != expected {
+		t.Errorf("Expected json to be %s, but was %s\n", expected, b)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// DepStatus tells how the checkout of a dependency compares
+// with what its config asks for and with its upstream.
+type DepStatus struct {
+	Import       string `json:"import"`
+	CheckoutType string `json:"checkout_type,omitempty"`
+	CheckoutSpec string `json:"checkout_spec,omitempty"`
+	// revision checked out in the vendor dir
+	Revision string `json:"revision,omitempty"`
+	// revision it should be at when it's not, see checkedOutAt
+	Expected string `json:"expected,omitempty"`
+	Dirty    bool   `json:"dirty"`
+	// upstream revisions the checkout is missing, only with --remote
+	Behind *int   `json:"behind,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// gp status [--remote]
+func statusCommand(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	remote := flags.Bool("remote", false, "ask upstream how many revisions every dependency is behind")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *remote && offline {
+		return &UsageError{"the status of upstream can't be checked offline"}
+	}
+
+	config, dependencies, err := loadConfiguration(".")
+	if err != nil {
+		return err
+	}
+	if dependencies == nil {
+		return NoDependenciesError(config)
+	}
+
+	if err := loadVendoredDependencies(dependencies); err != nil {
+		return err
+	}
+
+	statuses := []*DepStatus{}
+	for _, dep := range dependencies.Resolved() {
+		statuses = append(statuses, dependencyStatus(dep, *remote))
+	}
+
+	if format == JSONFormat {
+		return printJSON(struct {
+			Dependencies []*DepStatus `json:"dependencies"`
+		}{statuses})
+	}
+	printStatuses(statuses, *remote)
+	return nil
+}
+
+func dependencyStatus(d *Dep, remote bool) *DepStatus {
+	status := &DepStatus{
+		Import:       d.Import,
+		CheckoutType: d.CheckoutType(),
+		CheckoutSpec: d.CheckoutSpec}
+
+	if _, err := os.Stat(d.Src()); err != nil {
+		status.Error = "not vendored"
+		return status
+	}
+
+	scm, err := NewScm(d)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	if status.Revision, err = scm.Revision(d.Src()); err != nil {
+		status.Error = fmt.Sprintf("no revision checked out: %s", err)
+		return status
+	}
+	if expected, ok := d.checkedOutAt(status.Revision); !ok {
+		status.Expected = expected
+	}
+
+	changes, err := scm.Modified(d.Src())
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Dirty = len(changes) > 0
+
+	if remote {
+		branch := ""
+		if d.CheckoutFlag == BranchFlag {
+			branch = d.CheckoutSpec
+		}
+
+		behind, err := scm.Behind(d.Src(), branch)
+		if err != nil {
+			status.Error = fmt.Sprintf("can't reach upstream: %s", err)
+			return status
+		}
+		status.Behind = &behind
+	}
+
+	return status
+}
+
+// What the config asks for, like Dep.Spec.
+func (s *DepStatus) Requested() string {
+	if s.CheckoutType == "" {
+		return "default branch"
+	}
+	return fmt.Sprintf("%s %s", s.CheckoutType, s.CheckoutSpec)
+}
+
+func printStatuses(statuses []*DepStatus, remote bool) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+
+	header := "IMPORT\tREQUESTED\tREVISION\tDIRTY"
+	if remote {
+		header += "\tBEHIND"
+	}
+	fmt.Fprintln(writer, header)
+
+	for _, s := range statuses {
+		revision := shortRevision(s.Revision)
+		if s.Expected != "" {
+			revision += fmt.Sprintf(" (expected %s)", shortRevision(s.Expected))
+		}
+
+		dirty := "no"
+		if s.Dirty {
+			dirty = "yes"
+		}
+
+		line := fmt.Sprintf("%s\t%s\t%s\t%s", s.Import, s.Requested(), revision, dirty)
+		if remote {
+			behind := "-"
+			if s.Behind != nil {
+				behind = fmt.Sprint(*s.Behind)
+			}
+			line += "\t" + behind
+		}
+		if s.Error != "" {
+			line += "\t" + s.Error
+		}
+		fmt.Fprintln(writer, line)
+	}
+	writer.Flush()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestDependencyStatus(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	first := commitGitFile(t, repo, "lib.go", "package lib\n")
+	_, deps := setupGitProject(t, repo, `branch = "master"`)
+	dep := deps.DepList[0]
+
+	status := dependencyStatus(dep, false)
+	if status.Revision != first || status.Dirty || status.Behind != nil || status.Error != "" {
+		t.Errorf("Expected a clean checkout at %s, was %+v", first, status)
+	}
+	if status.Requested() != "branch master" {
+		t.Errorf("Expected the requested version to be branch master, was %s", status.Requested())
+	}
+
+	check(ioutil.WriteFile(filepath.Join(dep.Src(), "lib.go"), []byte("package lib\n\nvar Patched = true\n"), 0644))
+	if status = dependencyStatus(dep, false); !status.Dirty {
+		t.Errorf("Expected the checkout to be dirty")
+	}
+}
+
+func TestDependencyStatusBehindUpstream(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	first := commitGitFile(t, repo, "lib.go", "package lib\n")
+	_, deps := setupGitProject(t, repo, `branch = "master"`)
+	dep := deps.DepList[0]
+
+	commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 2\n")
+	commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 3\n")
+
+	status := dependencyStatus(dep, true)
+	if status.Behind == nil || *status.Behind != 2 {
+		t.Fatalf("Expected the checkout to be 2 revisions behind, was %+v", status)
+	}
+
+	if status.Revision != first {
+		t.Errorf("Expected the checkout to stay at %s, was %s", first, status.Revision)
+	}
+
+	behind, err := Git{}.Behind(dep.Src(), "")
+	if err != nil || behind != 2 {
+		t.Errorf("Expected the checkout to be 2 revisions behind the default branch, was %d %v", behind, err)
+	}
+}
+
+func TestDependencyStatusNotVendored(t *testing.T) {
+	setupTestPwd()
+	dep := &Dep{Import: "example.com/missing", Scm: GitTag}
+
+	if status := dependencyStatus(dep, false); status.Error == "" {
+		t.Errorf("Expected a dependency that isn't vendored to be reported")
+	}
+}
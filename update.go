@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Move the given dependencies forward to the latest upstream revision
+// of their branch or tag and record the new revisions in the lock file.
+// All the dependencies are updated when no import is given.
+// The configuration file is never modified.
+func updateDependencies(config *Config, dependencies *Dependencies, imports []string) error {
+	if offline {
+		return &UsageError{"dependencies can't be updated offline"}
+	}
+
+	deps, err := selectDependencies(dependencies, imports)
+	if err != nil {
+		return &UsageError{err.Error()}
+	}
+
+	for _, dep := range deps {
+		old, _ := dep.CurrentRevision()
+
+		config.Lock.Release(dep.Import)
+		dep.Revision = ""
+
+		if err := dep.Update(); err != nil {
+			return err
+		}
+
+		current, err := dep.CurrentRevision()
+		if err != nil {
+			return &ScmError{dep.Import, fmt.Errorf("couldn't find the revision: %s", err)}
+		}
+
+		if old == current {
+			fmtcolor(Gray, "%s %s (unchanged)\n", dep.Import, shortRevision(current))
+		} else {
+			fmtcolor(Green, "%s %s → %s\n", dep.Import, shortRevision(old), shortRevision(current))
+		}
+	}
+
+	if err = config.WriteLock(dependencies); err != nil {
+		return err
+	}
+	// so the next run doesn't fetch the updated deps again
+	return config.WriteFingerprints(dependencies)
+}
+
+// Pick the resolved dependencies matching imports, or all of them.
+func selectDependencies(dependencies *Dependencies, imports []string) ([]*Dep, error) {
+	resolved := dependencies.Resolved()
+	if len(imports) == 0 {
+		return resolved, nil
+	}
+
+	byImport := make(map[string]*Dep)
+	for _, dep := range resolved {
+		byImport[dep.Import] = dep
+	}
+
+	deps := []*Dep{}
+	for _, i := range imports {
+		dep, found := byImport[i]
+		if !found {
+			return nil, fmt.Errorf("%s is not a dependency of this project", i)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// Update fetches new upstream revisions for the dep
+// and checks out its branch or tag again.
+func (d *Dep) Update() error {
+	if _, err := os.Stat(d.Src()); os.IsNotExist(err) {
+		d.Fetch(true)
+		if err = d.Get(); err != nil {
+			return err
+		}
+	} else {
+		scm, err := NewScm(d)
+		if err != nil {
+			return &ScmError{d.Import, err}
+		}
+
+		d.printf(Gray, "fetching %s\n", d.Import)
+		if err = scm.Fetch(d.Src()); err != nil {
+			return &ScmError{d.Import, err}
+		}
+	}
+
+	var err error
+	if d.CheckoutType() != "" {
+		err = d.switchToBranchOrTag()
+	} else {
+		err = d.checkoutDefaultBranch()
+	}
+	if err != nil {
+		return &ScmError{d.Import, err}
+	}
+	return nil
+}
+
+// Move a dep without branch, commit or tag to the tip of the upstream
+// default branch, away from the revision the lock pinned it to.
+func (d *Dep) checkoutDefaultBranch() error {
+	scm, err := NewScm(d)
+	if err != nil {
+		return err
+	}
+	if g, ok := scm.(Go); ok {
+		scm = g.Scm
+	}
+
+	switch scm.(type) {
+	case Git:
+		return commandInPath(d.Src(), "git", "checkout", "-q", "--detach", "origin/HEAD").Run()
+	case Hg:
+		return commandInPath(d.Src(), "hg", "update", "default").Run()
+	case Bzr:
+		return commandInPath(d.Src(), "bzr", "update").Run()
+	}
+	// svn update already moved the working copy to the latest revision
+	return nil
+}
+
+func shortRevision(revision string) string {
+	if revision == "" {
+		return "(none)"
+	}
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestUpdateMovesBranchForward(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	config, deps := setupGitProject(t, repo, `branch = "master"`)
+
+	latest := commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 2\n")
+	check(updateDependencies(config, deps, []string{"example.com/lib"}))
+
+	revision, _ := deps.DepList[0].CurrentRevision()
+	if revision != latest {
+		t.Errorf("Expected dependency to be updated to %s but it was %s", latest, revision)
+	}
+
+	lock, _ := LoadLock(pwd)
+	if lock.Entries["example.com/lib"].Revision != latest {
+		t.Errorf("Expected lock to record the updated revision %s", latest)
+	}
+
+	if _, deps = loadTestConfiguration(pwd); deps.DepList[0].fetch {
+		t.Errorf("Expected the updated dependency not to be fetched again by the next run")
+	}
+}
+
+func TestUpdateMovesDefaultBranchForward(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	setupGitProject(t, repo, "")
+
+	// the next run checks the dependency out at its locked revision
+	config, deps := loadTestConfiguration(pwd)
+	check(loadTransitiveDependencies(deps))
+
+	latest := commitGitFile(t, repo, "lib.go", "package lib\n\nconst Version = 2\n")
+	check(updateDependencies(config, deps, nil))
+
+	revision, _ := deps.DepList[0].CurrentRevision()
+	if revision != latest {
+		t.Errorf("Expected dependency to be updated to %s but it was %s", latest, revision)
+	}
+
+	lock, _ := LoadLock(pwd)
+	if lock.Entries["example.com/lib"].Revision != latest {
+		t.Errorf("Expected lock to record the updated revision %s", latest)
+	}
+}
+
+func TestUpdateKeepsConfig(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	config, deps := setupGitProject(t, repo, `branch = "master"`)
+
+	before, _ := ioutil.ReadFile(config.Path)
+	check(updateDependencies(config, deps, nil))
+
+	if after, _ := ioutil.ReadFile(config.Path); string(after) != string(before) {
+		t.Errorf("Expected update to leave gopack.config untouched")
+	}
+}
+
+func TestSelectUnknownDependency(t *testing.T) {
+	repo := createGitRepo(t, "lib")
+	commitGitFile(t, repo, "lib.go", "package lib\n")
+	_, deps := setupGitProject(t, repo, `branch = "master"`)
+
+	if _, err := selectDependencies(deps, []string{"example.com/other"}); err == nil {
+		t.Errorf("Expected selecting an unknown dependency to fail")
+	}
+
+	selected, _ := selectDependencies(deps, nil)
+	if len(selected) != 1 {
+		t.Errorf("Expected to select every dependency when no import is given")
+	}
+}
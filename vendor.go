@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// gp vendor prune [--dry-run]
+func vendorCommand(dependencies *Dependencies, args []string) error {
+	if len(args) == 0 || args[0] != "prune" {
+		return &UsageError{"usage: gp vendor prune [--dry-run]"}
+	}
+
+	flags := flag.NewFlagSet("vendor prune", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "list the stale checkouts without deleting them")
+	if err := parseCommandFlags(flags, args[1:]); err != nil {
+		return err
+	}
+
+	orphans, err := findOrphans(dependencies.ImportGraph)
+	if err != nil {
+		return err
+	}
+
+	if len(orphans) == 0 {
+		fmtcolor(Green, "nothing to prune in %s\n", filepath.Join(pwd, VendorDir, "src"))
+		return nil
+	}
+
+	for _, orphan := range orphans {
+		if *dryRun {
+			fmtcolor(Gray, "would prune %s\n", orphan)
+			continue
+		}
+
+		fmtcolor(Gray, "pruning %s\n", orphan)
+		if err := os.RemoveAll(dependencyPath(orphan)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The paths under the vendor dir that no resolved dependency needs,
+// relative to its src dir. Paths leading to a dependency are kept, and
+// so is the whole repository a dependency was checked out from, as well
+// as the packages go get fetched along with the deps using it.
+func findOrphans(graph *Graph) ([]string, error) {
+	src := filepath.Join(pwd, VendorDir, "src")
+	orphans := []string{}
+
+	fetched, err := goGetPackages(graph)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == src {
+				return nil
+			}
+			return err
+		}
+		if path == src {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		importPath := filepath.ToSlash(rel)
+
+		node := graph.node(importPath)
+		if n := fetched.node(importPath); n != nil && (node == nil || n.Leaf) {
+			node = n
+		}
+		if node == nil {
+			orphans = append(orphans, importPath)
+		} else if !node.Leaf && !isRepositoryRoot(path) {
+			// keep looking for orphans on the way to the dependencies
+			return nil
+		}
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	return orphans, err
+}
+
+// The vendored packages the code of the deps with scm go imports, and
+// the ones these import in turn. No config declares them, go get
+// fetches them on its own.
+func goGetPackages(graph *Graph) (*Graph, error) {
+	fetched := NewGraph()
+	queue := []string{}
+	for _, d := range graph.Dependencies() {
+		if d.Scm == "go" {
+			queue = append(queue, d.Import)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		importPath := queue[0]
+		queue = queue[1:]
+		if seen[importPath] {
+			continue
+		}
+		seen[importPath] = true
+
+		if _, err := os.Stat(dependencyPath(importPath)); err != nil {
+			continue
+		}
+		fetched.Insert(NewDependency(importPath))
+
+		p, err := AnalyzeSourceTree(dependencyPath(importPath))
+		if err != nil {
+			return nil, fmt.Errorf("can't tell what go get fetched for %s: %s", importPath, err)
+		}
+		for i, s := range p.ImportStatsByPath {
+			if s.Remote {
+				queue = append(queue, i)
+			}
+		}
+	}
+	return fetched, nil
+}
+
+func isRepositoryRoot(dir string) bool {
+	for _, hidden := range HiddenDirs {
+		if _, err := os.Stat(filepath.Join(dir, hidden)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFindOrphans(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+	createFixtureConfig(pwd, `repo = "github.com/me/project"`)
+
+	graph := NewGraph()
+	check(loadTestConfig(pwd).InitRepo(graph))
+	graph.Insert(NewDependency("github.com/a/b"))
+	graph.Insert(NewDependency("github.com/c/d/sub"))
+	graph.Insert(NewDependency("github.com/e/f/sub"))
+
+	for _, dir := range []string{
+		"github.com/a/b/pkg",
+		"github.com/a/stale",
+		"github.com/c/d/.git",
+		"github.com/c/d/other",
+		"github.com/e/f/sub",
+		"github.com/e/f/other",
+		"github.com/x/y",
+		"example.com/old",
+	} {
+		createPath(dependencyPath(dir))
+	}
+	check(os.Symlink(pwd, dependencyPath("github.com/me/old-name")))
+
+	orphans, err := findOrphans(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "example.com,github.com/a/stale,github.com/e/f/other,github.com/me/old-name,github.com/x"
+	if strings.Join(orphans, ",") != expected {
+		t.Errorf("Expected orphans %s but they were %v", expected, orphans)
+	}
+}
+
+func TestFindOrphansFetchedByGoGet(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	dep := NewDependency("github.com/x/y/pkg")
+	dep.Scm = "go"
+	graph := NewGraph()
+	graph.Insert(dep)
+
+	for dir, imports := range map[string]string{
+		"github.com/x/y/pkg":   `"fmt"; "github.com/z/w"`,
+		"github.com/z/w":       `"example.com/deep/pkg"`,
+		"example.com/deep/pkg": `"strings"`,
+		"example.com/stale":    `"github.com/z/w"`,
+	} {
+		createPath(dependencyPath(dir))
+		source := fmt.Sprintf("package %s\n\nimport (%s)\n", path.Base(dir), imports)
+		check(ioutil.WriteFile(path.Join(dependencyPath(dir), "main.go"), []byte(source), 0644))
+	}
+
+	orphans, err := findOrphans(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(orphans, ",") != "example.com/stale" {
+		t.Errorf("Expected the packages go get fetched to be kept, orphans were %v", orphans)
+	}
+}
+
+func TestFindOrphansWithoutVendorDir(t *testing.T) {
+	setupTestPwd()
+
+	orphans, err := findOrphans(NewGraph())
+	if err != nil || len(orphans) != 0 {
+		t.Errorf("Expected no orphans without vendor dir but found %v, %v", orphans, err)
+	}
+}
+
+func TestPruneVendorDir(t *testing.T) {
+	setupTestPwd()
+	setupEnv()
+
+	dependencies := &Dependencies{ImportGraph: NewGraph()}
+	dependencies.ImportGraph.Insert(NewDependency("github.com/a/b"))
+	createPath(dependencyPath("github.com/a/b"))
+	createPath(dependencyPath("github.com/x/y"))
+
+	check(vendorCommand(dependencies, []string{"prune", "--dry-run"}))
+	if _, err := os.Stat(dependencyPath("github.com/x/y")); err != nil {
+		t.Errorf("Expected a dry run to keep the orphans")
+	}
+
+	check(vendorCommand(dependencies, []string{"prune"}))
+	if _, err := os.Stat(dependencyPath("github.com/x")); !os.IsNotExist(err) {
+		t.Errorf("Expected github.com/x to be pruned")
+	}
+	if _, err := os.Stat(dependencyPath("github.com/a/b")); err != nil {
+		t.Errorf("Expected github.com/a/b to be kept")
+	}
+}
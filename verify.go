@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gp verify [--hash]
+//
+// Check the vendored checkouts are the ones gopack.lock pins, without
+// fetching anything: every working copy has to be clean and at its
+// locked revision, and with --hash its content has to match the hash
+// recorded when the revision was locked.
+func verifyCommand(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	checkHash := flags.Bool("hash", false, "compare the content of the checkouts with the hashes in gopack.lock")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+
+	config, dependencies, err := loadConfiguration(".")
+	if err != nil {
+		return err
+	}
+	if dependencies == nil {
+		return NoDependenciesError(config)
+	}
+
+	if err := loadVendoredDependencies(dependencies); err != nil {
+		return err
+	}
+
+	errors := []*ProjectError{}
+	for _, dep := range dependencies.Resolved() {
+		problems := verifyDependency(dep, config.Lock, *checkHash)
+		if len(problems) == 0 {
+			revision, _ := dep.CurrentRevision()
+			fmtcolor(Green, "%s %s ok\n", dep.Import, shortRevision(revision))
+		}
+		errors = append(errors, problems...)
+	}
+
+	return validationError(errors)
+}
+
+// Load the configs of the vendored dependencies as they are, like
+// loadTransitiveDependencies does without fetching anything.
+func loadVendoredDependencies(dependencies *Dependencies) error {
+	level := []*Dependencies{dependencies}
+	loaded := make(map[string]bool)
+
+	for len(level) > 0 {
+		next, err := loadNextLevel(level, loaded)
+		if err != nil {
+			return err
+		}
+		level = next
+	}
+	return nil
+}
+
+// What's wrong with the checkout of the dep, if anything.
+func verifyDependency(d *Dep, lock *Lock, checkHash bool) []*ProjectError {
+	if d.Scm == LocalTag {
+		return nil
+	}
+
+	if _, err := os.Stat(d.Src()); err != nil {
+		return []*ProjectError{MissingDependencyError(d, "is not vendored")}
+	}
+
+	scm, err := NewScm(d)
+	if err != nil {
+		return []*ProjectError{VerifyError(d, ModifiedDep, fmt.Sprintf("can't be verified: %s", err))}
+	}
+
+	errors := []*ProjectError{}
+
+	revision, err := scm.Revision(d.Src())
+	if err != nil {
+		errors = append(errors, VerifyError(d, RevisionMismatch, fmt.Sprintf("has no revision checked out: %s", err)))
+	} else if expected, ok := d.checkedOutAt(revision); !ok {
+		errors = append(errors, VerifyError(d, RevisionMismatch,
+			fmt.Sprintf("is checked out at revision %s instead of %s", shortRevision(revision), shortRevision(expected))))
+	}
+
+	changes, err := scm.Modified(d.Src())
+	if err != nil {
+		errors = append(errors, VerifyError(d, ModifiedDep, fmt.Sprintf("has a working copy %s can't read: %s", d.Scm, err)))
+	} else if len(changes) > 0 {
+		errors = append(errors, VerifyError(d, ModifiedDep,
+			fmt.Sprintf("has local changes\n    %s", strings.Join(changes, "\n    "))))
+	}
+
+	if entry, found := lock.Entries[d.Import]; checkHash && found && entry.Matches(d) && entry.Hash != "" {
+		hash, err := treeHash(d.Src())
+		if err != nil {
+			errors = append(errors, VerifyError(d, ModifiedDep, fmt.Sprintf("can't be hashed: %s", err)))
+		} else if hash != entry.Hash {
+			errors = append(errors, VerifyError(d, ModifiedDep, "has a different content than the one locked in gopack.lock"))
+		}
+	}
+
+	return errors
+}
+
+// Whether revision is the one the checkout of the dep should be at,
+// the locked one or else the commit the config asks for, which may
+// be an abbreviated hash.
+func (d *Dep) checkedOutAt(revision string) (expected string, ok bool) {
+	switch {
+	case d.Revision != "":
+		return d.Revision, revision == d.Revision
+	case d.CheckoutFlag == CommitFlag:
+		return d.CheckoutSpec, revision == d.CheckoutSpec ||
+			(len(d.CheckoutSpec) >= 7 && strings.HasPrefix(revision, d.CheckoutSpec))
+	}
+	return "", true
+}
+
+// Hash the files of the tree in dir, their paths, contents and
+// whether they're executable, leaving out the scm metadata so the
+// hash of a checkout is the same on every machine.
+func treeHash(dir string) (string, error) {
+	hidden := make(map[string]bool)
+	for _, h := range HiddenDirs {
+		hidden[h] = true
+	}
+
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if hidden[info.Name()] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "link %s %s\n", rel, target)
+		case info.Mode().IsRegular():
+			sum, err := fileHash(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(h, "file %s %t %s\n", rel, info.Mode()&0111 != 0, sum)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setupVerifyProject(t *testing.T) (*Config, *Dep, []string) {
+	repo := createGitRepo(t, "lib")
+	first := commitGitFile(t, repo, ".gitignore", "*.log\n")
+	second := commitGitFile(t, repo, "lib.go", "package lib\n")
+
+	config, deps := setupGitProject(t, repo, `branch = "master"`)
+	return config, deps.DepList[0], []string{first, second}
+}
+
+func verifyKinds(d *Dep, lock *Lock, checkHash bool) []string {
+	kinds := []string{}
+	for _, e := range verifyDependency(d, lock, checkHash) {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestVerifyCleanCheckout(t *testing.T) {
+	config, dep, _ := setupVerifyProject(t)
+
+	if config.Lock.Entries[dep.Import].Hash == "" {
+		t.Fatal("Expected the lock to record the hash of the checkout")
+	}
+
+	if kinds := verifyKinds(dep, config.Lock, true); len(kinds) != 0 {
+		t.Errorf("Expected a clean checkout to verify, found %v", kinds)
+	}
+}
+
+func TestVerifyLocalChanges(t *testing.T) {
+	config, dep, _ := setupVerifyProject(t)
+	check(ioutil.WriteFile(filepath.Join(dep.Src(), "lib.go"), []byte("package lib\n\nvar Patched = true\n"), 0644))
+
+	kinds := verifyKinds(dep, config.Lock, false)
+	if len(kinds) != 1 || kinds[0] != ModifiedDep {
+		t.Errorf("Expected the local changes to be found, found %v", kinds)
+	}
+}
+
+func TestVerifyWrongRevision(t *testing.T) {
+	config, dep, revisions := setupVerifyProject(t)
+	git(t, dep.Src(), "checkout", "-q", revisions[0])
+
+	dep.Revision = config.Lock.Entries[dep.Import].Revision
+	kinds := verifyKinds(dep, config.Lock, false)
+	if len(kinds) != 1 || kinds[0] != RevisionMismatch {
+		t.Errorf("Expected the checkout to be at the wrong revision, found %v", kinds)
+	}
+}
+
+func TestVerifyContentHash(t *testing.T) {
+	config, dep, _ := setupVerifyProject(t)
+	// ignored by git, only the hash notices it
+	check(ioutil.WriteFile(filepath.Join(dep.Src(), "debug.log"), []byte("patched\n"), 0644))
+
+	if kinds := verifyKinds(dep, config.Lock, false); len(kinds) != 0 {
+		t.Fatalf("Expected the ignored file to go unnoticed without --hash, found %v", kinds)
+	}
+
+	kinds := verifyKinds(dep, config.Lock, true)
+	if len(kinds) != 1 || kinds[0] != ModifiedDep {
+		t.Errorf("Expected the content hash to differ, found %v", kinds)
+	}
+}
+
+func TestTreeHash(t *testing.T) {
+	a, _ := ioutil.TempDir("", "gopack-tree-")
+	b, _ := ioutil.TempDir("", "gopack-tree-")
+	for _, dir := range []string{a, b} {
+		createPath(filepath.Join(dir, "sub"))
+		check(ioutil.WriteFile(filepath.Join(dir, "sub", "a.go"), []byte("package sub\n"), 0644))
+	}
+
+	// scm metadata is left out
+	createPath(filepath.Join(b, HiddenGit))
+	check(ioutil.WriteFile(filepath.Join(b, HiddenGit, "HEAD"), []byte("ref: refs/heads/master\n"), 0644))
+
+	hashA, err := treeHash(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashB, _ := treeHash(b)
+	if hashA != hashB {
+		t.Errorf("Expected trees with the same files to have the same hash")
+	}
+
+	check(os.Chmod(filepath.Join(b, "sub", "a.go"), 0755))
+	if hashB, _ = treeHash(b); hashA == hashB {
+		t.Errorf("Expected the hash to change when a file becomes executable")
+	}
+}